@@ -0,0 +1,826 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rbicker/namedyn/namedyn"
+	"gopkg.in/yaml.v3"
+)
+
+// dualTypes returns the record types managed for the given type, dual
+// manages both an A and an AAAA record, which are optional.
+func dualTypes(typ string) ([]string, bool) {
+	if typ == "dual" {
+		return []string{"A", "AAAA"}, true
+	}
+	return []string{typ}, false
+}
+
+// validateType makes sure the given record type is supported, the target is
+// only defined for records not pointing to an ip and only A, AAAA and CNAME
+// records are proxied by cloudflare.
+func validateType(typ, target string, proxied bool) error {
+	switch {
+	case proxied && !namedyn.IsIPType(typ) && typ != "dual" && typ != "CNAME":
+		return fmt.Errorf("%s records can not be proxied by cloudflare, only A, AAAA and CNAME records", typ)
+	case (namedyn.IsIPType(typ) || typ == "dual") && target != "":
+		return fmt.Errorf("%s records point to the own public ip and do not support a target", typ)
+	case namedyn.IsIPType(typ) || typ == "dual":
+		return nil
+	case (typ == "CNAME" || typ == "TXT" || typ == "MX" || typ == "SRV") && target == "":
+		return fmt.Errorf("%s records require a target", typ)
+	case typ == "CNAME" || typ == "TXT" || typ == "MX" || typ == "SRV":
+		return nil
+	}
+	return fmt.Errorf("type %s is not supported", typ)
+}
+
+// cloudflareProxied returns true if the records of the given provider with the
+// given options are proxied by cloudflare, the proxied option takes precedence
+// over CLOUDFLARE_PROXIED. Invalid values are reported by the provider.
+func cloudflareProxied(provider string, s *settings, options map[string]string) bool {
+	if provider != "cloudflare" {
+		return false
+	}
+	if v, err := strconv.ParseBool(options["proxied"]); err == nil {
+		return v
+	}
+	v, _ := s.lookup("CLOUDFLARE_PROXIED")
+	proxied, _ := strconv.ParseBool(v)
+	return proxied
+}
+
+// typeProviders contains the record types supported by the providers which
+// do not support all of them, e.g. namecheap only sets the address of a host.
+var typeProviders = map[string][]string{"namecheap": {"A"}}
+
+// validateProviderType makes sure the given record type is supported by the
+// given provider.
+func validateProviderType(typ, provider string) error {
+	supported, ok := typeProviders[provider]
+	if !ok {
+		return nil
+	}
+	for _, t := range supported {
+		if t == typ {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s records are not supported by the %s provider, only %s records", typ, provider, strings.Join(supported, ", "))
+}
+
+// validateMultipleIPs makes sure the providers of the given entries are able
+// to publish multiple ips of a host, which namecheap is not, as it replaces
+// the address of the host with every update.
+func validateMultipleIPs(entries []namedyn.Entry) error {
+	for _, e := range entries {
+		if _, ok := e.Provider.(*namedyn.NamecheapProvider); ok {
+			return errors.New("multiple ips are not supported by the namecheap provider")
+		}
+	}
+	return nil
+}
+
+// priorityProviders contains the providers supporting the priority
+// of MX and SRV records as well as the weight and port of SRV records.
+var priorityProviders = map[string]bool{"namecom": true}
+
+// parsePriority parses the given priority of an MX or SRV record of the given
+// type managed by the given provider.
+func parsePriority(v, typ, provider string) (int32, error) {
+	if !priorityProviders[provider] {
+		return 0, fmt.Errorf("%s records are not supported by the %s provider", typ, provider)
+	}
+	return parseUint16(v, "priority")
+}
+
+// parseUint16 parses the given value of an MX or SRV record, e.g. its
+// port, which needs to be between 0 and 65535.
+func parseUint16(v, name string) (int32, error) {
+	i, err := strconv.ParseUint(strings.TrimSpace(v), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid %s between 0 and 65535", v, name)
+	}
+	return int32(i), nil
+}
+
+// ipifyURL returns the url of the given ipify compatible echo service
+// replying using the given format, which is either text or json.
+func ipifyURL(base, format string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(base))
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%s is not an http or https url", base)
+	}
+	q := u.Query()
+	q.Set("format", format)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// validateDomain makes sure the given domain looks like a domain name.
+func validateDomain(domain string) error {
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.ContainsAny(domain, " \t/:") {
+		return fmt.Errorf("%q is not a valid domain name, e.g. example.com", domain)
+	}
+	return nil
+}
+
+// normalizeHost returns the given host relative to the domain,
+// the root record given as @ is represented by an empty host.
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if host == "@" {
+		return ""
+	}
+	return host
+}
+
+// settings looks up configuration values by the name of their environment
+// variable and collects the problems with them, so they can be reported at once.
+type settings struct {
+	lookup func(key string) (string, bool)
+	// name returns the name of the given key in error messages.
+	name func(key string) string
+	// key returns the given key as named by the settings, kind describes
+	// them in the error message listing the missing keys.
+	key      func(key string) string
+	kind     string
+	missing  []string
+	problems []string
+}
+
+// envSettings returns settings looking up environment variables.
+func envSettings() *settings {
+	return &settings{
+		lookup: os.LookupEnv,
+		name:   func(key string) string { return "environment variable " + key },
+		key:    func(key string) string { return key },
+		kind:   "environment variables",
+	}
+}
+
+// mapSettings returns settings looking up the values of the given map,
+// which are keyed by the lowercase name of the environment variables.
+func mapSettings(m map[string]interface{}) *settings {
+	return &settings{
+		lookup: func(key string) (string, bool) {
+			v, ok := m[strings.ToLower(key)]
+			if !ok || v == nil {
+				return "", false
+			}
+			return fmt.Sprint(v), true
+		},
+		name: strings.ToLower,
+		key:  strings.ToLower,
+		kind: "settings",
+	}
+}
+
+// value returns the value of the given key. If the key suffixed with _FILE is
+// defined, the value is read from the file at the given path instead, which
+// allows to use docker or kubernetes secrets.
+func (s *settings) value(key string) (string, bool) {
+	path, ok := s.lookup(key + "_FILE")
+	if !ok {
+		return s.lookup(key)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s could not be read: %s", s.name(key+"_FILE"), err))
+		return "", true
+	}
+	return strings.TrimRight(string(b), " \t\r\n"), true
+}
+
+// required returns the value of the given key and records it as missing if it
+// is undefined or blank, e.g. if it is defined without a value in a compose file.
+func (s *settings) required(key string) string {
+	n := len(s.problems)
+	v, ok := s.value(key)
+	// files which could not be read have already been reported
+	if len(s.problems) == n && (!ok || strings.TrimSpace(v) == "") {
+		s.missing = append(s.missing, key)
+	}
+	return v
+}
+
+// secret returns the required value of the given key as a secret. If it is
+// read from a file, the file is read again whenever the secret is used.
+func (s *settings) secret(key string) namedyn.Secret {
+	v := s.required(key)
+	if path, ok := s.lookup(key + "_FILE"); ok {
+		return namedyn.NewFileSecret(path, v)
+	}
+	return namedyn.StaticSecret(v)
+}
+
+// optional returns the value of the given key or def if it is undefined.
+func (s *settings) optional(key, def string) string {
+	if v, ok := s.value(key); ok {
+		return v
+	}
+	return def
+}
+
+// bool returns the boolean value of the given key or def if it is undefined.
+func (s *settings) bool(key string, def bool) bool {
+	v, ok := s.value(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s is not a valid boolean", s.name(key)))
+	}
+	return b
+}
+
+// err returns an error listing all missing keys and other problems or nil if there are none.
+func (s *settings) err() error {
+	problems := s.problems
+	if len(s.missing) > 0 {
+		names := make([]string, len(s.missing))
+		for i, key := range s.missing {
+			names[i] = s.key(key)
+		}
+		problems = append([]string{fmt.Sprintf("missing required %s: %s", s.kind, strings.Join(names, ", "))}, problems...)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, ", "))
+}
+
+// newProvider returns the provider with the given name managing the records of
+// the given domain, configured by the given settings. It also returns the
+// minimum ttl allowed by the provider.
+func newProvider(cli namedyn.Doer, name, domain string, s *settings) (namedyn.Provider, int32) {
+	switch name {
+	case "namecom":
+		// 300 is the minimum ttl allowed by name.com
+		return namedyn.NewNameComProvider(cli, s.optional("API_BASE_URL", "https://api.name.com/v4"), s.secret("USERNAME"), s.secret("TOKEN"), domain), 300
+	case "cloudflare":
+		// 1 means automatic ttl for cloudflare
+		return namedyn.NewCloudflareProvider(cli, "https://api.cloudflare.com/client/v4", s.required("CLOUDFLARE_API_TOKEN"), domain, s.optional("CLOUDFLARE_ZONE_ID", ""), s.bool("CLOUDFLARE_PROXIED", false)), 1
+	case "clouddns":
+		// cloud dns does not enforce a minimum ttl
+		return namedyn.NewCloudDNSProvider(cli, "https://dns.googleapis.com/dns/v1", s.required("GCP_PROJECT"), s.required("GCP_ZONE"), domain), 0
+	case "digitalocean":
+		// 30 is the minimum ttl allowed by digitalocean
+		return namedyn.NewDigitalOceanProvider(cli, "https://api.digitalocean.com/v2", s.required("DO_TOKEN"), domain), 30
+	case "gandi":
+		token, apiKey := s.optional("GANDI_PAT", ""), s.optional("GANDI_API_KEY", "")
+		if token == "" && apiKey == "" {
+			s.problems = append(s.problems, fmt.Sprintf("%s or %s is undefined", s.name("GANDI_PAT"), s.name("GANDI_API_KEY")))
+		}
+		// 300 is the minimum ttl allowed by gandi
+		return namedyn.NewGandiProvider(cli, "https://api.gandi.net/v5/livedns", token, apiKey, domain), 300
+	case "hetzner":
+		// 60 is the minimum ttl allowed by hetzner
+		return namedyn.NewHetznerProvider(cli, "https://dns.hetzner.com/api/v1", s.required("HETZNER_DNS_TOKEN"), domain), 60
+	case "linode":
+		// 30 is the minimum ttl allowed by linode, others are rounded up to the next valid one
+		return namedyn.NewLinodeProvider(cli, "https://api.linode.com/v4", s.required("LINODE_TOKEN"), domain), 30
+	case "namecheap":
+		// the ttl is managed using the namecheap dashboard
+		return namedyn.NewNamecheapProvider(cli, "https://dynamicdns.park-your-domain.com", s.required("NAMECHEAP_PASSWORD"), domain), 0
+	case "ovh":
+		// 60 is the minimum ttl allowed by ovh
+		return namedyn.NewOVHProvider(cli, s.optional("OVH_ENDPOINT", "https://eu.api.ovh.com/1.0"), s.required("OVH_APPLICATION_KEY"), s.required("OVH_APPLICATION_SECRET"), s.required("OVH_CONSUMER_KEY"), domain), 60
+	case "porkbun":
+		// 600 is the minimum ttl allowed by porkbun
+		return namedyn.NewPorkbunProvider(cli, "https://api.porkbun.com/api/json/v3", s.required("PORKBUN_API_KEY"), s.required("PORKBUN_SECRET_KEY"), domain), 600
+	case "vultr":
+		// vultr does not enforce a minimum ttl
+		return namedyn.NewVultrProvider(cli, "https://api.vultr.com/v2", s.required("VULTR_API_KEY"), domain), 0
+	case "route53":
+		// route 53 does not enforce a minimum ttl
+		static := namedyn.AWSCredentials{
+			AccessKeyID:     s.optional("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: s.optional("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken:    s.optional("AWS_SESSION_TOKEN", ""),
+		}
+		return namedyn.NewRoute53Provider(cli, "https://route53.amazonaws.com", s.required("ROUTE53_ZONE_ID"), domain, static), 0
+	}
+	s.problems = append(s.problems, fmt.Sprintf("unknown provider %s", name))
+	return nil, 0
+}
+
+// parseOptions parses the given comma separated list of provider specific
+// record options, e.g. proxied=true.
+func parseOptions(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	options := make(map[string]string)
+	for _, o := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(o, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s is not a key=value pair", strings.TrimSpace(o))
+		}
+		options[k] = strings.TrimSpace(v)
+	}
+	return options, nil
+}
+
+// fileValues contains the provider settings or the record options of the
+// configuration file. Their scalars are kept as written, so a token like 0123
+// is not parsed as a number, and null values are omitted.
+type fileValues map[string]interface{}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *fileValues) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %v: expected a mapping", n.Line)
+	}
+	m := make(fileValues, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %v: %s needs to be a scalar", value.Line, key.Value)
+		}
+		if value.ShortTag() != "!!null" {
+			m[key.Value] = value.Value
+		}
+	}
+	*v = m
+	return nil
+}
+
+// fileOptions returns the given options of the configuration file.
+func fileOptions(m fileValues) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	options := make(map[string]string, len(m))
+	for k, v := range m {
+		if v != nil {
+			options[k] = fmt.Sprint(v)
+		}
+	}
+	return options
+}
+
+// defaultTTL returns the ttl of records which do not define one, which is 300
+// unless the provider requires a higher one.
+func defaultTTL(minTTL int32) int32 {
+	if minTTL > 300 {
+		return minTTL
+	}
+	return 300
+}
+
+// parseTTL parses the given ttl and makes sure it is at least minTTL.
+func parseTTL(s string, minTTL int32) (int32, error) {
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid number", s)
+	}
+	if i < int64(minTTL) {
+		return 0, fmt.Errorf("needs to be at least %v, got %v", minTTL, i)
+	}
+	return int32(i), nil
+}
+
+// parseHost parses the given element of the HOST list, which may override the
+// given type and ttl using suffixes separated by slashes, e.g. home/AAAA/60.
+func parseHost(h, typ string, ttl, minTTL int32) (string, string, int32, error) {
+	parts := strings.Split(h, "/")
+	host := strings.TrimSpace(parts[0])
+	for _, o := range parts[1:] {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			return "", "", 0, fmt.Errorf("%s contains an empty override", strings.TrimSpace(h))
+		}
+		if _, err := strconv.Atoi(o); err == nil {
+			t, err := parseTTL(o, minTTL)
+			if err != nil {
+				return "", "", 0, fmt.Errorf("ttl of %s %s", host, err)
+			}
+			ttl = t
+			continue
+		}
+		typ = o
+	}
+	return normalizeHost(host), typ, ttl, nil
+}
+
+// loadEnvEntries returns the entries configured by the given environment
+// settings, the problems with them are collected by the settings.
+func loadEnvEntries(cli namedyn.Doer, s *settings) []namedyn.Entry {
+	var hosts []string
+	// the root record needs to be given as @, so empty
+	// hosts, e.g. caused by a trailing comma, are ignored
+	if v := s.required("HOST"); strings.TrimSpace(v) != "" {
+		for _, h := range strings.Split(v, ",") {
+			if strings.TrimSpace(h) != "" {
+				hosts = append(hosts, h)
+			}
+		}
+		if len(hosts) == 0 {
+			s.missing = append(s.missing, "HOST")
+		}
+	}
+	domain := strings.TrimSpace(s.required("DOMAIN"))
+	if domain != "" {
+		if err := validateDomain(domain); err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("environment variable DOMAIN is invalid: %s", err))
+		}
+	}
+	provider := s.optional("PROVIDER", "namecom")
+	p, minTTL := newProvider(cli, provider, domain, s)
+	ttl := defaultTTL(minTTL)
+	if v, ok := s.value("TTL"); ok {
+		t, err := parseTTL(v, minTTL)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("environment variable TTL is invalid: %s", err))
+		}
+		ttl = t
+	}
+	typ := s.optional("TYPE", "A")
+	// VALUE is more natural for TXT records
+	target := s.optional("TARGET", s.optional("VALUE", ""))
+	options, err := parseOptions(s.optional("RECORD_OPTIONS", ""))
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("environment variable RECORD_OPTIONS is invalid: %s", err))
+	}
+	proxied := cloudflareProxied(provider, s, options)
+	if err := validateType(typ, target, proxied); err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("environment variable TYPE is invalid: %s", err))
+	} else if err := validateProviderType(typ, provider); err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("environment variable TYPE is invalid: %s", err))
+	}
+	ipv6 := s.bool("ENABLE_IPV6", false)
+	if ipv6 {
+		if err := validateProviderType("AAAA", provider); err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("environment variable ENABLE_IPV6 is invalid: %s", err))
+		}
+	}
+	// the priority, weight and port are only parsed once,
+	// so their problems are only reported once
+	var priority, weight, port int32
+	priorityParsed, srvParsed := false, false
+	var entries []namedyn.Entry
+	// multiple hosts can be given as comma separated list,
+	// each of them may override the type and the ttl
+	for _, h := range hosts {
+		host, hostType, hostTTL, err := parseHost(h, typ, ttl, minTTL)
+		if err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("environment variable HOST is invalid: %s", err))
+			continue
+		}
+		// the global type has already been validated
+		if hostType != typ {
+			if err := validateType(hostType, target, proxied); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("environment variable HOST is invalid: the type of %s is invalid: %s", strings.TrimSpace(h), err))
+				continue
+			}
+			if err := validateProviderType(hostType, provider); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("environment variable HOST is invalid: the type of %s is invalid: %s", strings.TrimSpace(h), err))
+				continue
+			}
+		}
+		if (hostType == "MX" || hostType == "SRV") && p != nil && !priorityParsed {
+			v, err := parsePriority(s.optional("PRIORITY", "10"), hostType, provider)
+			if err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("environment variable PRIORITY is invalid: %s", err))
+			}
+			priority, priorityParsed = v, true
+		}
+		if hostType == "SRV" && !srvParsed {
+			var err error
+			if weight, err = parseUint16(s.optional("WEIGHT", "0"), "weight"); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("environment variable WEIGHT is invalid: %s", err))
+			}
+			if v := s.required("PORT"); v != "" {
+				if port, err = parseUint16(v, "port"); err != nil {
+					s.problems = append(s.problems, fmt.Sprintf("environment variable PORT is invalid: %s", err))
+				}
+			}
+			srvParsed = true
+		}
+		types, optional := dualTypes(hostType)
+		if hostType == "A" && ipv6 {
+			types = append(types, "AAAA")
+		}
+		for _, t := range types {
+			e := namedyn.Entry{
+				Host:     host,
+				Domain:   domain,
+				Type:     t,
+				Target:   namedyn.NormalizeAnswer(t, target),
+				TTL:      hostTTL,
+				Provider: p,
+				Optional: optional,
+				Options:  options,
+			}
+			switch t {
+			case "MX":
+				e.Priority = priority
+			case "SRV":
+				e.Priority, e.Weight, e.Port = priority, weight, port
+			}
+			entries = append(entries, e)
+		}
+	}
+	if s.err() != nil {
+		return nil
+	}
+	return entries
+}
+
+// fileConfig represents the configuration file.
+type fileConfig struct {
+	// Defaults are used by the entries and mappings which do not define them.
+	Defaults fileDefaults  `yaml:"defaults"`
+	Entries  []fileEntry   `yaml:"entries"`
+	Mappings []fileMapping `yaml:"mappings"`
+}
+
+// fileDefaults represents the defaults of the configuration file.
+type fileDefaults struct {
+	// Type is the type of the entries, the type of mappings
+	// only falls back to it if it is A, AAAA or dual.
+	Type string `yaml:"type"`
+	TTL  int32  `yaml:"ttl"`
+}
+
+// fileEntry represents an entry of the configuration file.
+type fileEntry struct {
+	Host   string `yaml:"host"`
+	Domain string `yaml:"domain"`
+	// Type defaults to A, dual manages both an A and an AAAA record.
+	Type string `yaml:"type"`
+	// Target is the static answer of records not pointing to the own public ip.
+	Target string `yaml:"target"`
+	// Value is an alias of Target.
+	Value string `yaml:"value"`
+	// TTL defaults to 300 or the minimum ttl of the provider if it is higher.
+	TTL int32 `yaml:"ttl"`
+	// Priority is the preference of MX and SRV records, it defaults to 10.
+	Priority *int32 `yaml:"priority"`
+	// Weight defaults to 0, Weight and Port are only used by SRV records.
+	Weight int32 `yaml:"weight"`
+	Port   int32 `yaml:"port"`
+	// Options contains provider specific settings of the record, e.g. proxied.
+	Options fileValues `yaml:"options"`
+	// Provider contains the name of the provider and its settings,
+	// which are named like their environment variables in lowercase.
+	Provider fileValues `yaml:"provider"`
+}
+
+// dynamicAnswer is the answer of mapped hosts pointing to the own public ip.
+const dynamicAnswer = "@dynamic"
+
+// fileMapping represents a mapping of the configuration file, which manages
+// the records of a domain by host, e.g. of a small zone.
+type fileMapping struct {
+	Domain string `yaml:"domain"`
+	// Type is the type of the records pointing to the own public ip,
+	// either A, AAAA or dual, it defaults to A.
+	Type string `yaml:"type"`
+	// TTL defaults to 300 or the minimum ttl of the provider if it is higher.
+	TTL int32 `yaml:"ttl"`
+	// Records contains the answers by host, which are @dynamic for the own
+	// public ip, an IPv4 or IPv6 address for A or AAAA records or the target
+	// of CNAME records.
+	Records map[string]string `yaml:"records"`
+	// Options are applied to all records of the mapping.
+	Options fileValues `yaml:"options"`
+	// Provider is configured like the provider of the entries.
+	Provider fileValues `yaml:"provider"`
+}
+
+// fileProvider returns the provider configured by the given settings and the
+// given ttl, which defaults to defaultTTL. The problems are collected by the settings.
+func fileProvider(cli namedyn.Doer, s *settings, domain string, ttl int32) (namedyn.Provider, int32) {
+	name, _ := s.lookup("NAME")
+	if name == "" {
+		s.problems = append(s.problems, "provider name is undefined")
+		return nil, ttl
+	}
+	p, minTTL := newProvider(cli, name, domain, s)
+	if ttl == 0 {
+		ttl = defaultTTL(minTTL)
+	}
+	if ttl < minTTL {
+		s.problems = append(s.problems, fmt.Sprintf("ttl needs to be at least %v, got %v", minTTL, ttl))
+	}
+	return p, ttl
+}
+
+// mappingEntries returns the entries of the given mapping, the problems
+// with them are collected by the settings.
+func mappingEntries(cli namedyn.Doer, fm fileMapping, s *settings) []namedyn.Entry {
+	domain := strings.TrimSpace(fm.Domain)
+	if domain == "" {
+		s.problems = append(s.problems, "domain is undefined")
+	} else if err := validateDomain(domain); err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("domain is invalid: %s", err))
+	}
+	if len(fm.Records) == 0 {
+		s.problems = append(s.problems, "records are undefined")
+	}
+	dynamic := fm.Type
+	if dynamic == "" {
+		dynamic = "A"
+	}
+	name, _ := s.lookup("NAME")
+	if !namedyn.IsIPType(dynamic) && dynamic != "dual" {
+		s.problems = append(s.problems, fmt.Sprintf("type needs to be one of A, AAAA or dual, got %s", dynamic))
+	} else if err := validateProviderType(dynamic, name); err != nil {
+		s.problems = append(s.problems, err.Error())
+	}
+	p, ttl := fileProvider(cli, s, domain, fm.TTL)
+	hosts := make([]string, 0, len(fm.Records))
+	for h := range fm.Records {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	var entries []namedyn.Entry
+	for _, h := range hosts {
+		e := namedyn.Entry{Host: normalizeHost(h), Domain: domain, TTL: ttl, Provider: p, Options: fileOptions(fm.Options)}
+		answer := strings.TrimSpace(fm.Records[h])
+		switch {
+		case answer == dynamicAnswer:
+			types, optional := dualTypes(dynamic)
+			for _, typ := range types {
+				e.Type, e.Optional = typ, optional
+				entries = append(entries, e)
+			}
+			continue
+		case answer == "":
+			s.problems = append(s.problems, fmt.Sprintf("the answer of %s is undefined", h))
+		default:
+			// the static answers are published like the targets of cnames
+			if ip, typ, err := namedyn.ParseIP(answer); err == nil {
+				e.Type, e.Target = typ, ip
+			} else {
+				e.Type, e.Target = "CNAME", namedyn.NormalizeAnswer("CNAME", answer)
+			}
+			if err := validateProviderType(e.Type, name); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("the answer of %s is invalid: %s", h, err))
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// parseConfigFile parses the given yaml configuration file. Keys not matching
+// a setting are rejected, so a typo does not silently fall back to the default.
+func parseConfigFile(b []byte) (fileConfig, error) {
+	var cfg fileConfig
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	// an empty file is reported as not containing any entries
+	if err := d.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fileConfig{}, err
+	}
+	return cfg, nil
+}
+
+// loadConfigFile reads the entries from the yaml configuration file at path.
+func loadConfigFile(cli namedyn.Doer, path string) ([]namedyn.Entry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfigFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+	if len(cfg.Entries) == 0 && len(cfg.Mappings) == 0 {
+		return nil, fmt.Errorf("config file %s does not contain any entries or mappings", path)
+	}
+	var entries []namedyn.Entry
+	var problems []string
+	d := cfg.Defaults
+	for i, fe := range cfg.Entries {
+		s := mapSettings(fe.Provider)
+		if fe.Type == "" {
+			fe.Type = d.Type
+		}
+		if fe.TTL == 0 {
+			fe.TTL = d.TTL
+		}
+		e := namedyn.Entry{
+			Host:    normalizeHost(fe.Host),
+			Domain:  strings.TrimSpace(fe.Domain),
+			Type:    fe.Type,
+			Target:  fe.Target,
+			TTL:     fe.TTL,
+			Options: fileOptions(fe.Options),
+		}
+		if e.Target == "" {
+			e.Target = fe.Value
+		}
+		if strings.TrimSpace(fe.Host) == "" {
+			s.problems = append(s.problems, "host is undefined")
+		}
+		if e.Domain == "" {
+			s.problems = append(s.problems, "domain is undefined")
+		} else if err := validateDomain(e.Domain); err != nil {
+			s.problems = append(s.problems, fmt.Sprintf("domain is invalid: %s", err))
+		}
+		if e.Type == "" {
+			e.Type = "A"
+		}
+		name, _ := s.lookup("NAME")
+		if err := validateType(e.Type, e.Target, cloudflareProxied(name, s, e.Options)); err != nil {
+			s.problems = append(s.problems, err.Error())
+		} else if err := validateProviderType(e.Type, name); err != nil {
+			s.problems = append(s.problems, err.Error())
+		}
+		e.Target = namedyn.NormalizeAnswer(e.Type, e.Target)
+		e.Provider, e.TTL = fileProvider(cli, s, e.Domain, e.TTL)
+		if (e.Type == "MX" || e.Type == "SRV") && e.Provider != nil {
+			priority := "10"
+			if fe.Priority != nil {
+				priority = strconv.Itoa(int(*fe.Priority))
+			}
+			v, err := parsePriority(priority, e.Type, name)
+			if err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("priority is invalid: %s", err))
+			}
+			e.Priority = v
+		}
+		if e.Type == "SRV" {
+			var err error
+			if e.Weight, err = parseUint16(strconv.Itoa(int(fe.Weight)), "weight"); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("weight is invalid: %s", err))
+			}
+			if fe.Port == 0 {
+				s.problems = append(s.problems, "port is undefined")
+			} else if e.Port, err = parseUint16(strconv.Itoa(int(fe.Port)), "port"); err != nil {
+				s.problems = append(s.problems, fmt.Sprintf("port is invalid: %s", err))
+			}
+		}
+		if err := s.err(); err != nil {
+			problems = append(problems, fmt.Sprintf("entry %v: %s", i+1, err))
+		}
+		types, optional := dualTypes(e.Type)
+		for _, typ := range types {
+			e.Type, e.Optional = typ, optional
+			entries = append(entries, e)
+		}
+	}
+	for i, fm := range cfg.Mappings {
+		s := mapSettings(fm.Provider)
+		if fm.Type == "" && (namedyn.IsIPType(d.Type) || d.Type == "dual") {
+			fm.Type = d.Type
+		}
+		if fm.TTL == 0 {
+			fm.TTL = d.TTL
+		}
+		entries = append(entries, mappingEntries(cli, fm, s)...)
+		if err := s.err(); err != nil {
+			problems = append(problems, fmt.Sprintf("mapping %v: %s", i+1, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config file %s: %s", path, strings.Join(problems, "; "))
+	}
+	return entries, nil
+}
+
+// entryTypes returns the distinct record types of the given entries
+// pointing to the own public ip.
+func entryTypes(entries []namedyn.Entry) []string {
+	m := make(map[string]bool)
+	for _, e := range entries {
+		if e.Target == "" {
+			m[e.Type] = true
+		}
+	}
+	var types []string
+	for t := range m {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// optionalType returns true if all entries of the given type pointing to the
+// own public ip are optional.
+func optionalType(entries []namedyn.Entry, typ string) bool {
+	for _, e := range entries {
+		if e.Type == typ && e.Target == "" && !e.Optional {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rbicker/namedyn/namedyn"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "home", want: "home"},
+		{host: " home ", want: "home"},
+		{host: "@", want: ""},
+		{host: " @ ", want: ""},
+		{host: "", want: ""},
+		{host: "*", want: "*"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHost(tt.host); got != tt.want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvEntriesMX(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		priority int32
+		err      string
+	}{
+		{
+			name:     "priority",
+			settings: map[string]interface{}{"priority": "20"},
+			priority: 20,
+		},
+		{
+			name:     "default priority",
+			settings: map[string]interface{}{},
+			priority: 10,
+		},
+		{
+			name:     "invalid priority",
+			settings: map[string]interface{}{"priority": "70000"},
+			err:      "environment variable PRIORITY is invalid: 70000 is not a valid priority between 0 and 65535",
+		},
+		{
+			name:     "unsupported provider",
+			settings: map[string]interface{}{"provider": "cloudflare", "cloudflare_api_token": "token", "cloudflare_zone_id": "zone"},
+			err:      "MX records are not supported by the cloudflare provider",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"host": "@", "domain": "example.com", "type": "MX", "target": "mail.example.com", "username": "user", "token": "token"}
+			for k, v := range tt.settings {
+				m[k] = v
+			}
+			s := mapSettings(m)
+			entries := loadEnvEntries(http.DefaultClient, s)
+			err := s.err()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %v entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Host != "" || e.Type != "MX" || e.Target != "mail.example.com" || e.Priority != tt.priority {
+				t.Errorf("got entry %+v, want an MX record of the root pointing to mail.example.com with priority %v", e, tt.priority)
+			}
+		})
+	}
+}
+
+func TestLoadEnvEntriesNormalizesTarget(t *testing.T) {
+	s := mapSettings(map[string]interface{}{"host": "www", "domain": "example.com", "type": "CNAME", "target": "Target.Example.net.", "username": "user", "token": "token"})
+	entries := loadEnvEntries(http.DefaultClient, s)
+	if err := s.err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Target != "target.example.net" {
+		t.Errorf("got entries %+v, want one pointing to target.example.net", entries)
+	}
+}
+
+func TestLoadEnvEntriesCloudflareProxied(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "proxied txt record",
+			settings: map[string]interface{}{"type": "TXT", "value": "v", "cloudflare_proxied": "true"},
+			err:      "environment variable TYPE is invalid: TXT records can not be proxied by cloudflare",
+		},
+		{
+			name:     "txt record proxied by option",
+			settings: map[string]interface{}{"type": "TXT", "value": "v", "record_options": "proxied=true"},
+			err:      "environment variable TYPE is invalid: TXT records can not be proxied by cloudflare",
+		},
+		{
+			name:     "host overriding the type",
+			settings: map[string]interface{}{"host": "home,_acme/TXT", "value": "", "cloudflare_proxied": "true"},
+			err:      "the type of _acme/TXT is invalid: TXT records can not be proxied by cloudflare",
+		},
+		{
+			name:     "txt record not proxied by option",
+			settings: map[string]interface{}{"type": "TXT", "value": "v", "cloudflare_proxied": "true", "record_options": "proxied=false"},
+		},
+		{
+			name:     "proxied cname record",
+			settings: map[string]interface{}{"type": "CNAME", "target": "target.example.net", "cloudflare_proxied": "true"},
+		},
+		{
+			name:     "proxied dual record",
+			settings: map[string]interface{}{"type": "dual", "cloudflare_proxied": "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"host": "home", "domain": "example.com", "provider": "cloudflare", "cloudflare_api_token": "token", "cloudflare_zone_id": "zone"}
+			for k, v := range tt.settings {
+				m[k] = v
+			}
+			s := mapSettings(m)
+			loadEnvEntries(http.DefaultClient, s)
+			err := s.err()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadEnvEntriesSRV(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		weight   int32
+		port     int32
+		err      string
+	}{
+		{
+			name:     "weight and port",
+			settings: map[string]interface{}{"weight": "5", "port": "5060"},
+			weight:   5,
+			port:     5060,
+		},
+		{
+			name:     "default weight",
+			settings: map[string]interface{}{"port": "5060"},
+			port:     5060,
+		},
+		{
+			name:     "missing port",
+			settings: map[string]interface{}{"weight": "5"},
+			err:      "missing required settings: port",
+		},
+		{
+			name:     "invalid weight",
+			settings: map[string]interface{}{"weight": "-1", "port": "5060"},
+			err:      "environment variable WEIGHT is invalid: -1 is not a valid weight between 0 and 65535",
+		},
+		{
+			name:     "invalid port",
+			settings: map[string]interface{}{"port": "65536"},
+			err:      "environment variable PORT is invalid: 65536 is not a valid port between 0 and 65535",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"host": "_sip._tcp", "domain": "example.com", "type": "SRV", "target": "sip.example.com", "priority": "20", "username": "user", "token": "token"}
+			for k, v := range tt.settings {
+				m[k] = v
+			}
+			s := mapSettings(m)
+			entries := loadEnvEntries(http.DefaultClient, s)
+			err := s.err()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %v entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Type != "SRV" || e.Target != "sip.example.com" || e.Priority != 20 || e.Weight != tt.weight || e.Port != tt.port {
+				t.Errorf("got entry %+v, want priority 20, weight %v and port %v", e, tt.weight, tt.port)
+			}
+		})
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		ttl      int32
+		err      string
+	}{
+		{
+			name:     "namecom",
+			settings: map[string]interface{}{"username": "user", "token": "token"},
+			ttl:      300,
+		},
+		{
+			name:     "porkbun",
+			settings: map[string]interface{}{"provider": "porkbun", "porkbun_api_key": "key", "porkbun_secret_key": "secret"},
+			ttl:      600,
+		},
+		{
+			name:     "porkbun with a too short ttl",
+			settings: map[string]interface{}{"provider": "porkbun", "porkbun_api_key": "key", "porkbun_secret_key": "secret", "ttl": "300"},
+			err:      "environment variable TTL is invalid: needs to be at least 600, got 300",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"host": "home", "domain": "example.com"}
+			for k, v := range tt.settings {
+				m[k] = v
+			}
+			s := mapSettings(m)
+			entries := loadEnvEntries(http.DefaultClient, s)
+			err := s.err()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(entries) != 1 || entries[0].TTL != tt.ttl {
+				t.Errorf("got entries %+v, want one with ttl %v", entries, tt.ttl)
+			}
+		})
+	}
+	t.Run("config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		config := `entries:
+  - host: home
+    domain: example.com
+    provider:
+      name: porkbun
+      porkbun_api_key: key
+      porkbun_secret_key: secret
+`
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := loadConfigFile(http.DefaultClient, path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(entries) != 1 || entries[0].TTL != 600 {
+			t.Errorf("got entries %+v, want one with ttl 600", entries)
+		}
+	})
+}
+
+func TestLoadEnvEntriesNamecheap(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "a record",
+			settings: map[string]interface{}{},
+		},
+		{
+			name:     "aaaa record",
+			settings: map[string]interface{}{"type": "AAAA"},
+			err:      "environment variable TYPE is invalid: AAAA records are not supported by the namecheap provider, only A records",
+		},
+		{
+			name:     "dual record",
+			settings: map[string]interface{}{"type": "dual"},
+			err:      "environment variable TYPE is invalid: dual records are not supported by the namecheap provider",
+		},
+		{
+			name:     "cname record",
+			settings: map[string]interface{}{"type": "CNAME", "target": "target.example.net"},
+			err:      "environment variable TYPE is invalid: CNAME records are not supported by the namecheap provider",
+		},
+		{
+			name:     "txt record",
+			settings: map[string]interface{}{"type": "TXT", "value": "v"},
+			err:      "environment variable TYPE is invalid: TXT records are not supported by the namecheap provider",
+		},
+		{
+			name:     "host overriding the type",
+			settings: map[string]interface{}{"host": "home,ipv6/AAAA"},
+			err:      "the type of ipv6/AAAA is invalid: AAAA records are not supported by the namecheap provider",
+		},
+		{
+			name:     "ipv6",
+			settings: map[string]interface{}{"enable_ipv6": "true"},
+			err:      "environment variable ENABLE_IPV6 is invalid: AAAA records are not supported by the namecheap provider",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]interface{}{"host": "home", "domain": "example.com", "provider": "namecheap", "namecheap_password": "secret"}
+			for k, v := range tt.settings {
+				m[k] = v
+			}
+			s := mapSettings(m)
+			loadEnvEntries(http.DefaultClient, s)
+			err := s.err()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileNamecheap(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "a record",
+			config: "entries:\n  - host: home\n    domain: example.com\n",
+		},
+		{
+			name:   "txt record",
+			config: "entries:\n  - host: home\n    domain: example.com\n    type: TXT\n    value: v\n",
+			err:    "entry 1: TXT records are not supported by the namecheap provider",
+		},
+		{
+			name:   "dynamic mapping",
+			config: "mappings:\n  - domain: example.com\n    records: {home: '@dynamic'}\n",
+		},
+		{
+			name:   "dual mapping",
+			config: "mappings:\n  - domain: example.com\n    type: dual\n    records: {home: '@dynamic'}\n",
+			err:    "mapping 1: dual records are not supported by the namecheap provider",
+		},
+		{
+			name:   "mapped cname",
+			config: "mappings:\n  - domain: example.com\n    records: {www: target.example.net}\n",
+			err:    "mapping 1: the answer of www is invalid: CNAME records are not supported by the namecheap provider",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the provider is added to the entry or mapping
+			config := strings.Replace(tt.config, "domain: example.com\n", "domain: example.com\n    provider: {name: namecheap, namecheap_password: secret}\n", 1)
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadConfigFile(http.DefaultClient, path)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateMultipleIPs(t *testing.T) {
+	namecheap := namedyn.NewNamecheapProvider(http.DefaultClient, "https://dynamicdns.park-your-domain.com", "secret", "example.com")
+	namecom := namedyn.NewNameComProvider(http.DefaultClient, "https://api.name.com/v4", namedyn.StaticSecret("user"), namedyn.StaticSecret("token"), "example.com")
+	if err := validateMultipleIPs([]namedyn.Entry{{Host: "home", Type: "A", Provider: namecom}}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := validateMultipleIPs([]namedyn.Entry{{Host: "home", Type: "A", Provider: namecom}, {Host: "home", Type: "A", Provider: namecheap}}); err == nil {
+		t.Error("expected an error for the namecheap provider")
+	}
+}
+
+func TestMappingEntries(t *testing.T) {
+	namecom := fileValues{"name": "namecom", "username": "user", "token": "token"}
+	tests := []struct {
+		name    string
+		mapping fileMapping
+		// want contains the entries as host/type/target, optional entries
+		// are suffixed by a question mark.
+		want []string
+		ttl  int32
+		err  string
+	}{
+		{
+			name:    "mapped hosts",
+			mapping: fileMapping{Domain: "example.com", Provider: namecom, Records: map[string]string{"home": "@dynamic", "@": " @dynamic ", "nas": "198.51.100.1", "v6": "2001:db8::1", "www": "Target.Example.net."}},
+			want:    []string{"/A/", "home/A/", "nas/A/198.51.100.1", "v6/AAAA/2001:db8::1", "www/CNAME/target.example.net"},
+			ttl:     300,
+		},
+		{
+			name:    "aaaa type",
+			mapping: fileMapping{Domain: "example.com", Type: "AAAA", TTL: 600, Provider: namecom, Records: map[string]string{"home": "@dynamic", "nas": "198.51.100.1"}},
+			want:    []string{"home/AAAA/", "nas/A/198.51.100.1"},
+			ttl:     600,
+		},
+		{
+			name:    "dual type",
+			mapping: fileMapping{Domain: "example.com", Type: "dual", Provider: namecom, Records: map[string]string{"home": "@dynamic"}},
+			want:    []string{"home/A/?", "home/AAAA/?"},
+			ttl:     300,
+		},
+		{
+			name:    "invalid type",
+			mapping: fileMapping{Domain: "example.com", Type: "CNAME", Provider: namecom, Records: map[string]string{"home": "@dynamic"}},
+			err:     "type needs to be one of A, AAAA or dual, got CNAME",
+		},
+		{
+			name:    "undefined provider",
+			mapping: fileMapping{Domain: "example.com", Records: map[string]string{"home": "@dynamic"}},
+			err:     "provider name is undefined",
+		},
+		{
+			name:    "unknown provider",
+			mapping: fileMapping{Domain: "example.com", Provider: fileValues{"name": "unknown"}, Records: map[string]string{"home": "@dynamic"}},
+			err:     "unknown provider unknown",
+		},
+		{
+			name:    "missing provider setting",
+			mapping: fileMapping{Domain: "example.com", Provider: fileValues{"name": "namecom", "username": "user"}, Records: map[string]string{"home": "@dynamic"}},
+			err:     "missing required settings: token",
+		},
+		{
+			name:    "too short ttl",
+			mapping: fileMapping{Domain: "example.com", TTL: 60, Provider: namecom, Records: map[string]string{"home": "@dynamic"}},
+			err:     "ttl needs to be at least 300, got 60",
+		},
+		{
+			name:    "undefined answer",
+			mapping: fileMapping{Domain: "example.com", Provider: namecom, Records: map[string]string{"home": " "}},
+			err:     "the answer of home is undefined",
+		},
+		{
+			name:    "undefined records",
+			mapping: fileMapping{Domain: "example.com", Provider: namecom},
+			err:     "records are undefined",
+		},
+		{
+			name:    "invalid domain",
+			mapping: fileMapping{Domain: "example", Provider: namecom, Records: map[string]string{"home": "@dynamic"}},
+			err:     "domain is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := mapSettings(tt.mapping.Provider)
+			entries := mappingEntries(http.DefaultClient, tt.mapping, s)
+			err := s.err()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got []string
+			for _, e := range entries {
+				v := e.Host + "/" + e.Type + "/" + e.Target
+				if e.Optional {
+					v += "?"
+				}
+				got = append(got, v)
+				if e.Domain != "example.com" || e.TTL != tt.ttl || e.Provider == nil {
+					t.Errorf("got entry %+v, want one of example.com with ttl %v and a provider", e, tt.ttl)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got entries %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	doc := `
+defaults:
+  ttl: 600
+entries:
+  - host: 123
+    domain: example.com
+    type: TXT
+    value: 0123
+    options: {proxied: true, note: ~}
+    provider:
+      name: namecom
+      username: user
+      token: 0123
+      api_key: 1_000
+      secret: 12345678901234567890
+`
+	cfg, err := parseConfigFile([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.Defaults.TTL != 600 {
+		t.Errorf("got default ttl %v, want 600", cfg.Defaults.TTL)
+	}
+	if len(cfg.Entries) != 1 {
+		t.Fatalf("got %v entries, want 1", len(cfg.Entries))
+	}
+	e := cfg.Entries[0]
+	if e.Host != "123" || e.Domain != "example.com" || e.Type != "TXT" || e.Value != "0123" {
+		t.Errorf("got entry %+v", e)
+	}
+	if got := fileOptions(e.Options); !reflect.DeepEqual(got, map[string]string{"proxied": "true"}) {
+		t.Errorf("got options %v", got)
+	}
+	s := mapSettings(e.Provider)
+	for key, want := range map[string]string{"TOKEN": "0123", "API_KEY": "1_000", "SECRET": "12345678901234567890"} {
+		if got, _ := s.lookup(key); got != want {
+			t.Errorf("got %s %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestParseConfigFileEmpty(t *testing.T) {
+	cfg, err := parseConfigFile([]byte("# only a comment\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cfg.Entries) != 0 || len(cfg.Mappings) != 0 {
+		t.Errorf("got config %+v, want it to be empty", cfg)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "entry", doc: "entries:\n  - host: home\n    domain: example.com\n    tll: 60\n", want: "line 4: field tll not found"},
+		{name: "top level", doc: "entry:\n  - host: home\n", want: "line 1: field entry not found"},
+		{name: "defaults", doc: "defaults:\n  type: A\n  ttl: 60\n  prio: 5\n", want: "line 4: field prio not found"},
+		{name: "mapping", doc: "mappings:\n  - domain: example.com\n    record: {home: '@dynamic'}\n", want: "line 3: field record not found"},
+		{name: "flow mapping", doc: "entries:\n  - {host: home, tll: 60}\n", want: "line 2: field tll not found"},
+		{name: "nested provider setting", doc: "entries:\n  - host: home\n    provider:\n      name: [namecom]\n", want: "line 4: name needs to be a scalar"},
+		{name: "invalid ttl", doc: "entries:\n  - host: home\n    ttl: soon\n", want: "line 3: cannot unmarshal !!str `soon`"},
+		{name: "provider settings", doc: "entries:\n  - host: home\n    provider: {name: namecom, any_setting: x}\n    options: {anything: true}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfigFile([]byte(tt.doc))
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
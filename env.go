@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envString returns the value of the given environment
+// variable or def if it is undefined.
+func envString(key, def string) string {
+	if s, ok := os.LookupEnv(key); ok {
+		return s
+	}
+	return def
+}
+
+// envBool returns the boolean value of the given environment variable
+// or def if it is undefined. It aborts if the value is not a valid boolean.
+func envBool(key string, def bool) bool {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatalf("environment variable %s is not a valid boolean: %s", key, err)
+	}
+	return b
+}
+
+// envDuration returns the duration value of the given environment variable
+// or def if it is undefined. It aborts if the value is not a positive duration.
+func envDuration(key string, def time.Duration) time.Duration {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("environment variable %s is not a valid duration: %s", key, err)
+	}
+	if d <= 0 {
+		log.Fatalf("environment variable %s needs to be a positive duration, got %s", key, s)
+	}
+	return d
+}
+
+// envList returns the values of the given comma separated environment
+// variable or the values of def if it is undefined. Empty values are omitted.
+func envList(key, def string) []string {
+	var l []string
+	for _, s := range strings.Split(envString(key, def), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+// envInt returns the integer value of the given environment variable or def
+// if it is undefined. It aborts if the value is not a non-negative integer.
+func envInt(key string, def int) int {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("environment variable %s is not a valid number: %s", key, err)
+	}
+	if i < 0 {
+		log.Fatalf("environment variable %s must not be negative, got %v", key, i)
+	}
+	return i
+}
+
+// envFloat returns the float value of the given environment variable or def
+// if it is undefined. It aborts if the value is not a valid number.
+func envFloat(key string, def float64) float64 {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Fatalf("environment variable %s is not a valid number: %s", key, err)
+	}
+	return f
+}
@@ -1,178 +1,497 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/rbicker/namedyn/namedyn"
 )
 
 func main() {
-	username, ok := os.LookupEnv("USERNAME")
-	if !ok {
-		log.Fatalf("environment variable USERNAME is undefined, aborting...")
+	once := flag.Bool("once", envBool("RUN_ONCE", false), "run a single cycle and exit, the exit code is non-zero if the cycle failed")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	configCheck := flag.Bool("config-check", false, "validate the configuration, print the managed records and exit without contacting any api")
+	skipSelfTest := flag.Bool("skip-self-test", envBool("SKIP_SELF_TEST", false), "do not verify the credentials of the providers on startup")
+	flag.Parse()
+	if *printVersion {
+		fmt.Println(versionString())
+		return
 	}
-	token, ok := os.LookupEnv("TOKEN")
-	if !ok {
-		log.Fatalf("environment variable TOKEN is undefined, aborting...")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envString("LOG_LEVEL", "info"))); err != nil {
+		log.Fatalf("environment variable LOG_LEVEL is invalid: %s", err)
 	}
-	host, ok := os.LookupEnv("HOST")
-	if !ok {
-		log.Fatalf("environment variable HOST is undefined, aborting...")
+	logger, err := namedyn.NewLogger(log.Writer(), envString("LOG_FORMAT", "text"), level)
+	if err != nil {
+		log.Fatalf("environment variable LOG_FORMAT is invalid: %s", err)
 	}
-	domain, ok := os.LookupEnv("DOMAIN")
-	if !ok {
-		log.Fatalf("environment variable DOMAIN is undefined, aborting...")
+	namedyn.SetLogger(logger)
+	logger.Info("starting", "version", version, "commit", commit, "date", date, "go", runtime.Version())
+	interval := envDuration("INTERVAL", 10*time.Second)
+	intervalJitter := envFloat("INTERVAL_JITTER", 0)
+	if intervalJitter < 0 || intervalJitter > 1 {
+		log.Fatalf("environment variable INTERVAL_JITTER needs to be between 0 and 1, got %v", intervalJitter)
 	}
-	for {
-		run(username, token, host, domain)
-		time.Sleep(10 * time.Second)
-	}
-
-}
-
-// NameRecord represents the record type from the name.com api
-// (https://www.name.com/api-docs/types/record).
-type NameRecord struct {
-	Id     int32  `json:"id"`
-	Host   string `json:"host"`
-	Type   string `json:"type"`
-	Answer string `json:"answer"`
-	TTL    int32  `json:"ttl"`
-}
-
-// NameListRecordsReply represents the reply while listing
-// records using the name.com api.
-type NameListRecordsReply struct {
-	Records []NameRecord `json:"records"`
-}
-
-// findRecord searches for the host A record.
-func findRecord(username, token, host, domain string) (*NameRecord, error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://api.name.com/v4/domains/%s/records", domain), nil)
+	transport, err := namedyn.NewTransport(envString("PROXY_URL", ""))
 	if err != nil {
-		return nil, fmt.Errorf("error while creating request to list dns records using name.com api: %s", err)
+		log.Fatalf("environment variable PROXY_URL is invalid: %s", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(username, token)
-	cli := &http.Client{}
-	res, err := cli.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error while querying list of dns records using name.com api: %s", err)
+	// a single client is shared by all requests to allow connection pooling
+	cli := newHTTPClient(transport)
+	httpTimeout := cli.Timeout
+	// the problems with the configuration are reported together
+	// after the notifiers have been configured as well
+	s := envSettings()
+	var entries []namedyn.Entry
+	var configErr error
+	if path, ok := os.LookupEnv("CONFIG_FILE"); ok {
+		entries, configErr = loadConfigFile(cli, path)
+	} else {
+		entries = loadEnvEntries(cli, s)
 	}
-	defer res.Body.Close()
-	var listReply NameListRecordsReply
-	err = json.NewDecoder(res.Body).Decode(&listReply)
-	if err != nil {
-		return nil, fmt.Errorf("could not decode the reply while listing name.com records: %s", err)
+	// the ipify compatible echo services may be self-hosted,
+	// they reply with the plain ip or using json
+	ipifyFormat := envString("IPIFY_FORMAT", "text")
+	if ipifyFormat != "text" && ipifyFormat != "json" {
+		log.Fatalf("environment variable IPIFY_FORMAT needs to be either text or json, got %s", ipifyFormat)
 	}
-	if res.StatusCode != 200 {
-		b, _ := ioutil.ReadAll(res.Body)
-		return nil, fmt.Errorf("unexpected status code %v while listing dns record using name.com api: %s", res.StatusCode, string(b))
+	ipify := map[string]string{"A": "https://api.ipify.org", "AAAA": "https://api6.ipify.org"}
+	for typ, key := range map[string]string{"A": "IPIFY_URL", "AAAA": "IPIFY6_URL"} {
+		u, err := ipifyURL(envString(key, ipify[typ]), ipifyFormat)
+		if err != nil {
+			log.Fatalf("environment variable %s is invalid: %s", key, err)
+		}
+		ipify[typ] = u
+	}
+	// the default ip sources depend on the way the own public ip is looked up
+	defaultSources := map[string]string{
+		"A":    ipify["A"],
+		"AAAA": ipify["AAAA"],
+	}
+	switch s := envString("IP_SOURCE", "http"); s {
+	case "http":
+	case "dns":
+		defaultSources["A"] = "dns:opendns,dns:google"
+		defaultSources["AAAA"] = "dns:opendns,dns:google"
+	case "doh":
+		defaultSources["A"] = "doh:cloudflare"
+		defaultSources["AAAA"] = "doh:cloudflare"
+	case "upnp":
+		// gateways only report their external IPv4 address
+		defaultSources["A"] = "upnp," + defaultSources["A"]
+	default:
+		log.Fatalf("environment variable IP_SOURCE needs to be one of http, dns, doh or upnp, got %s", s)
 	}
-	// search for dns
-	for _, r := range listReply.Records {
-		if r.Host == host && r.Type == "A" {
-			return &r, nil
+	// static ips are published in addition to the looked up ones
+	static := make(map[string][]string)
+	for _, s := range envList("IPS", "") {
+		ip, typ, err := namedyn.ParseIP(s)
+		if err != nil {
+			log.Fatalf("environment variable IPS contains the invalid ip %s", s)
 		}
+		static[typ] = append(static[typ], ip)
 	}
-	return nil, nil
-}
-
-// run creates or updates the dynamic record if necessary.
-func run(username, token, host, domain string) {
-	hostname := fmt.Sprintf("%s.%s", host, domain)
-	// query current record
-	r, err := findRecord(username, token, host, domain)
-	if err != nil {
-		log.Printf("ERROR: error while looking for existing record: %s", err)
-		return
+	// fixed ips are used instead of looking up the own public ip
+	fixed := make(map[string]string)
+	for _, s := range envList("PUBLIC_IP", "") {
+		ip, typ, err := namedyn.ParseIP(s)
+		if err != nil {
+			log.Fatalf("environment variable PUBLIC_IP contains the invalid ip %s", s)
+		}
+		if _, ok := fixed[typ]; ok {
+			log.Fatalf("environment variable PUBLIC_IP contains multiple ips of type %s", typ)
+		}
+		fixed[typ] = ip
 	}
-	// check own public ip
-	res, err := http.Get("https://api.ipify.org?format=text")
-	if err != nil {
-		log.Printf("ERROR: error while querying ipify api to lookup own ip: %s", err)
-		return
+	// fallback ips are used if the own public ip could not be looked up
+	fallbacks := make(map[string]string)
+	for _, s := range envList("FALLBACK_IP", "") {
+		ip, typ, err := namedyn.ParseIP(s)
+		if err != nil {
+			log.Fatalf("environment variable FALLBACK_IP contains the invalid ip %s", s)
+		}
+		if _, ok := fallbacks[typ]; ok {
+			log.Fatalf("environment variable FALLBACK_IP contains multiple ips of type %s", typ)
+		}
+		fallbacks[typ] = ip
 	}
-	defer res.Body.Close()
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("ERROR: error while reading response body from ipify api: %s", err)
-		return
+	multipleIPs := envBool("MULTIPLE_IPS", false) || len(static) > 0
+	if multipleIPs {
+		if err := validateMultipleIPs(entries); err != nil {
+			log.Fatalf("environment variable MULTIPLE_IPS or IPS is invalid: %s", err)
+		}
+	}
+	duplicates := envString("DUPLICATE_RECORDS", "first")
+	if duplicates != "first" && duplicates != "all" && duplicates != "delete" {
+		log.Fatalf("environment variable DUPLICATE_RECORDS needs to be one of first, all or delete, got %s", duplicates)
+	}
+	var families []namedyn.IPFamily
+	for _, typ := range entryTypes(entries) {
+		if !namedyn.IsIPType(typ) {
+			continue
+		}
+		f := namedyn.IPFamily{
+			Type:         typ,
+			Interface:    envString("IP_INTERFACE", ""),
+			Fallback:     envBool("IP_INTERFACE_FALLBACK", false),
+			All:          envBool("MULTIPLE_IPS", false),
+			Static:       static[typ],
+			Fixed:        fixed[typ],
+			FallbackIP:   fallbacks[typ],
+			Optional:     optionalType(entries, typ),
+			AllowPrivate: envBool("ALLOW_PRIVATE_IP", false),
+		}
+		switch typ {
+		case "A":
+			f.Sources = envList("IP_SOURCES", defaultSources[typ])
+		case "AAAA":
+			f.Sources = envList("IP6_SOURCES", defaultSources[typ])
+		}
+		f.JSONPaths = make(map[string]string)
+		if ipifyFormat == "json" {
+			f.JSONPaths[ipify[typ]] = ".ip"
+		}
+		// the custom source is tried first, e.g. the local api of the router
+		if u, ok := os.LookupEnv("IP_SOURCE_URL"); ok {
+			f.Sources = append([]string{u}, f.Sources...)
+			if path := envString("IP_SOURCE_JSONPATH", ""); path != "" {
+				f.JSONPaths[u] = path
+			}
+		}
+		families = append(families, f)
+	}
+	u := namedyn.NewUpdater(cli, entries, families)
+	u.DryRun = envBool("DRY_RUN", false)
+	u.MultipleIPs = multipleIPs
+	u.Duplicates = duplicates
+	u.UpdateOnly = envBool("UPDATE_ONLY", false)
+	u.WarnOnConflict = envBool("WARN_ON_CONFLICT", false)
+	u.AllowOverwrite = envBool("ALLOW_OVERWRITE", false)
+	u.MarkRecords = envBool("MARK_RECORDS", false)
+	u.StrictOwnership = envBool("STRICT_OWNERSHIP", false)
+	for _, e := range entries {
+		// neither the records nor the markers can be looked up using the dynamic dns api
+		if _, ok := e.Provider.(*namedyn.NamecheapProvider); !ok {
+			continue
+		}
+		if u.MarkRecords || u.StrictOwnership {
+			log.Fatalf("MARK_RECORDS and STRICT_OWNERSHIP are not supported by the namecheap provider, aborting...")
+		}
+		// existing records are never found, so no record would be set
+		if u.UpdateOnly {
+			log.Fatalf("UPDATE_ONLY is not supported by the namecheap provider, aborting...")
+		}
+	}
+	u.Resync = envDuration("RESYNC_INTERVAL", time.Hour)
+	u.StateFile = envString("STATE_FILE", "")
+	u.Concurrency = envInt("MAX_CONCURRENCY", 4)
+	u.AlertAfter = envInt("ALERT_AFTER", 3)
+	u.Health = namedyn.NewHealth(envDuration("HEALTH_MAX_AGE", 3*interval))
+	u.Timeout = envDuration("CYCLE_TIMEOUT", 5*time.Minute)
+	u.ListTimeout = envDuration("LIST_TIMEOUT", httpTimeout)
+	u.UpdateTimeout = envDuration("UPDATE_TIMEOUT", httpTimeout)
+	u.ConfirmChanges = envInt("CONFIRM_CHANGES", 1)
+	u.BreakerThreshold = envInt("CIRCUIT_BREAKER_THRESHOLD", 5)
+	u.BreakerCooldown = envDuration("CIRCUIT_BREAKER_COOLDOWN", 10*time.Minute)
+	if size := envInt("HISTORY_SIZE", 20); size > 0 {
+		u.History = namedyn.NewHistory(size)
+	}
+	u.LoadState()
+	if envBool("VERIFY_DNS", false) {
+		u.Verifier = namedyn.NewDNSVerifier(envString("VERIFY_DNS_RESOLVER", ""), envDuration("VERIFY_DNS_TIMEOUT", 2*time.Minute))
+	}
+	if url, ok := os.LookupEnv("WEBHOOK_URL"); ok {
+		u.Notifiers = append(u.Notifiers, namedyn.NewWebhookNotifier(cli, url))
+	}
+	if url, ok := os.LookupEnv("SLACK_WEBHOOK_URL"); ok {
+		u.Notifiers = append(u.Notifiers, namedyn.NewSlackNotifier(cli, url))
+	}
+	if token, ok := os.LookupEnv("TELEGRAM_BOT_TOKEN"); ok {
+		chatID, ok := os.LookupEnv("TELEGRAM_CHAT_ID")
+		if !ok {
+			s.missing = append(s.missing, "TELEGRAM_CHAT_ID")
+		}
+		u.Notifiers = append(u.Notifiers, namedyn.NewTelegramNotifier(cli, token, chatID))
+	}
+	if host, ok := os.LookupEnv("SMTP_HOST"); ok {
+		from, ok := os.LookupEnv("MAIL_FROM")
+		if !ok {
+			s.missing = append(s.missing, "MAIL_FROM")
+		}
+		to := envList("MAIL_TO", "")
+		if len(to) == 0 {
+			s.missing = append(s.missing, "MAIL_TO")
+		}
+		u.Notifiers = append(u.Notifiers, namedyn.NewSMTPNotifier(host, envInt("SMTP_PORT", 587), envString("SMTP_USER", ""), envString("SMTP_PASS", ""), from, to))
 	}
-	if res.StatusCode != 200 {
-		log.Printf("ERROR: unexpected status code %v while looking up own ip: %s", res.StatusCode, err)
+	if command, ok := os.LookupEnv("ON_CHANGE_CMD"); ok {
+		u.Notifiers = append(u.Notifiers, namedyn.NewCommandNotifier(command, envDuration("ON_CHANGE_TIMEOUT", 30*time.Second)))
+	}
+	var problems []string
+	if configErr != nil {
+		problems = append(problems, configErr.Error())
+	}
+	if err := s.err(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		log.Fatalf("%s, aborting...", strings.Join(problems, ", "))
+	}
+	// LISTEN_ADDR serves all endpoints on a single port, HEALTH_ADDR and
+	// METRICS_ADDR are only used if it is undefined
+	listenAddr, listen := os.LookupEnv("LISTEN_ADDR")
+	_, healthAddr := os.LookupEnv("HEALTH_ADDR")
+	var refresh *namedyn.Refresher
+	if token, ok := os.LookupEnv("REFRESH_TOKEN"); ok {
+		if !listen && !healthAddr {
+			log.Fatalf("environment variable REFRESH_TOKEN requires LISTEN_ADDR or HEALTH_ADDR, aborting...")
+		}
+		if refresh, err = namedyn.NewRefresher(token); err != nil {
+			log.Fatalf("environment variable REFRESH_TOKEN is invalid: %s, aborting...", err)
+		}
+		// a single cycle never reads the requests, which would block forever
+		if *once {
+			logger.Warn("REFRESH_TOKEN is ignored when running once, /refresh is not served")
+			refresh = nil
+		}
+	}
+	if *configCheck {
+		printConfig(os.Stdout, entries, families)
 		return
 	}
-	ip := string(b)
-	// if record does not exist
-	if r == nil {
-		// create record
-		r := NameRecord{
-			Host:   host,
-			Type:   "A",
-			Answer: ip,
-			TTL:    300, // minimum TTL unfortunately
-		}
-		body, err := json.Marshal(r)
-		if err != nil {
-			log.Printf("ERROR: error while creating request body to add dns record using name.com api: %s", err)
-			return
+	if listen {
+		if err := namedyn.Serve(listenAddr, u.Health, refresh, u.History); err != nil {
+			log.Fatalf("could not listen on LISTEN_ADDR %s: %s", listenAddr, err)
 		}
-		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://api.name.com/v4/domains/%s/records", domain), bytes.NewBuffer(body))
-		if err != nil {
-			log.Printf("ERROR: error while creating request to add dns record using name.com api: %s", err)
-			return
+	} else {
+		if addr, ok := os.LookupEnv("HEALTH_ADDR"); ok {
+			logger.Warn("HEALTH_ADDR is deprecated, use LISTEN_ADDR instead")
+			if err := namedyn.ServeHealth(addr, u.Health, refresh, u.History); err != nil {
+				log.Fatalf("could not listen on HEALTH_ADDR %s: %s", addr, err)
+			}
 		}
-		req.Header.Set("Content-Type", "application/json")
-		req.SetBasicAuth(username, token)
-		cli := &http.Client{}
-		res, err := cli.Do(req)
-		if err != nil {
-			log.Printf("ERROR: error while creating dns record using name.com api: %s", err)
-			return
+		if addr, ok := os.LookupEnv("METRICS_ADDR"); ok {
+			logger.Warn("METRICS_ADDR is deprecated, use LISTEN_ADDR instead")
+			if err := namedyn.ServeMetrics(addr); err != nil {
+				log.Fatalf("could not listen on METRICS_ADDR %s: %s", addr, err)
+			}
 		}
-		if res.StatusCode != 200 {
-			b, _ := ioutil.ReadAll(res.Body)
-			log.Printf("ERROR: unexpected status code %v while creating dns record using name api: %s", res.StatusCode, string(b))
-			return
+	}
+	// the privileges are dropped once the ports have been bound
+	if name, ok := os.LookupEnv("RUN_AS_USER"); ok {
+		if err := dropPrivileges(name); err != nil {
+			log.Fatalf("could not switch to RUN_AS_USER %s: %s, aborting...", name, err)
+		}
+		logger.Info("dropped privileges", "user", name)
+	}
+	// the context gets cancelled as soon as the process receives
+	// a signal to terminate, the current cycle is finished before returning
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if !*skipSelfTest {
+		if err := namedyn.SelfTest(ctx, entries); err != nil {
+			log.Fatalf("%s, aborting...", err)
+		}
+	}
+	u.LogManaged(ctx)
+	if *once {
+		ok := u.Cycle(ctx)
+		// the propagation checks would be aborted by exiting
+		u.Wait()
+		if !ok {
+			os.Exit(1)
 		}
-		log.Printf("INFO: created host A record %s with ip %s", hostname, ip)
 		return
 	}
-	// record exists
-	if r.Answer != ip {
-		oldIp := r.Answer
-		// ip has changed and needs to be updated
-		r.Answer = ip
-		body, err := json.Marshal(r)
-		if err != nil {
-			log.Printf("ERROR: error while creating request body to update dns record using name api: %s", err)
+	if !envBool("SKIP_INTERVAL_CHECK", false) {
+		checkInterval(logger, interval, entries)
+	}
+	cleanupOnExit := envBool("CLEANUP_ON_EXIT", false)
+	maxBackoff := envDuration("MAX_BACKOFF", 10*time.Minute)
+	failures := 0
+	// refreshes stays nil and is never selected without a refresher
+	var refreshes <-chan chan bool
+	if refresh != nil {
+		refreshes = refresh.Requests()
+	}
+	// systemd is notified once the first cycle succeeded and keeps the service
+	// alive as long as the following ones succeed within the watchdog timeout
+	watchdog := watchdogTimeout()
+	if watchdog > 0 && watchdog <= interval {
+		logger.Warn("the systemd watchdog timeout is shorter than the interval, the service gets restarted between the cycles", "watchdog", watchdog, "interval", interval)
+	}
+	ready := false
+	var result chan bool
+	for {
+		delay := interval
+		ok := u.Cycle(ctx)
+		if result != nil {
+			result <- ok
+			result = nil
 		}
-		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("https://api.name.com/v4/domains/%s/records/%v", domain, r.Id), bytes.NewBuffer(body))
-		if err != nil {
-			log.Printf("ERROR: error while creating request to update dns record using name api: %s", err)
-			return
+		if ok {
+			if failures > 0 {
+				logger.Info("cycle succeeded, backoff reset", "failures", failures)
+			}
+			failures = 0
+			if !ready {
+				if err := sdNotify("READY=1"); err != nil {
+					logger.Warn("could not notify systemd about readiness", "error", err)
+				}
+				ready = true
+			}
+			if watchdog > 0 {
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					logger.Warn("could not notify the systemd watchdog", "error", err)
+				}
+			}
+		} else {
+			failures++
+			delay = backoffInterval(interval, maxBackoff, failures)
+			logger.Warn("cycle failed, backing off", "failures", failures, "delay", delay)
 		}
-		req.Header.Set("Content-Type", "application/json")
-		req.SetBasicAuth(username, token)
-		cli := &http.Client{}
-		res, err := cli.Do(req)
-		if err != nil {
-			log.Printf("ERROR: error while updating dns record using name api: %s", err)
+		select {
+		case <-ctx.Done():
+			logger.Info("shutting down")
+			if err := sdNotify("STOPPING=1"); err != nil {
+				logger.Warn("could not notify systemd about stopping", "error", err)
+			}
+			if cleanupOnExit {
+				// the signal context is already cancelled
+				cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				u.Cleanup(cleanupCtx)
+				cancel()
+			}
 			return
+		case <-time.After(jitter(delay, intervalJitter)):
+		case result = <-refreshes:
 		}
-		if res.StatusCode != 200 {
-			b, _ := ioutil.ReadAll(res.Body)
-			log.Printf("ERROR: unexpected status code %v while updating dns record using name api: %s", res.StatusCode, string(b))
-			return
+	}
+}
+
+// printConfig writes a summary of the records managed for the given entries
+// and of the ways the own public ips are looked up to w.
+func printConfig(w io.Writer, entries []namedyn.Entry, families []namedyn.IPFamily) {
+	fmt.Fprintln(w, "the configuration is valid, managing the following records:")
+	for _, e := range entries {
+		answer := e.Target
+		switch e.Type {
+		case "MX":
+			answer = fmt.Sprintf("%s (priority %v)", answer, e.Priority)
+		case "SRV":
+			answer = fmt.Sprintf("%s (priority %v, weight %v, port %v)", answer, e.Priority, e.Weight, e.Port)
 		}
-		log.Printf("INFO: updated host A record %s, changed ip from %s to %s", hostname, oldIp, ip)
-		return
+		if answer == "" {
+			answer = "own public ip"
+			if e.Optional {
+				answer += " (optional)"
+			}
+		}
+		provider := namedyn.ProviderName(e.Provider)
+		var options []string
+		for k, v := range e.Options {
+			options = append(options, k+"="+v)
+		}
+		sort.Strings(options)
+		if len(options) > 0 {
+			provider += ", options " + strings.Join(options, ",")
+		}
+		fmt.Fprintf(w, "  %s %s -> %s (ttl %v, provider %s)\n", e.Hostname(), e.Type, answer, e.TTL, provider)
+	}
+	for _, f := range families {
+		var sources []string
+		switch {
+		case f.Fixed != "":
+			fmt.Fprintf(w, "the own public %s ip is %s\n", f.Type, f.Fixed)
+			continue
+		case f.Interface != "":
+			sources = []string{"interface " + f.Interface}
+			if f.Fallback {
+				sources = append(sources, f.Sources...)
+			}
+		default:
+			sources = f.Sources
+		}
+		fmt.Fprintf(w, "the own public %s ip is looked up using %s\n", f.Type, strings.Join(sources, ", "))
 	}
+}
 
+// checkInterval logs a warning if the given interval does not suit the ttls
+// of the entries. Much shorter intervals waste requests, as resolvers cache
+// the records anyway, much longer ones delay the recovery from ip changes.
+func checkInterval(logger *slog.Logger, interval time.Duration, entries []namedyn.Entry) {
+	var shortest, longest time.Duration
+	for _, e := range entries {
+		// the providers choose the ttl if it is 0 or 1
+		if e.TTL <= 1 {
+			continue
+		}
+		ttl := time.Duration(e.TTL) * time.Second
+		if shortest == 0 || ttl < shortest {
+			shortest = ttl
+		}
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	switch {
+	case shortest == 0:
+	case interval*100 < shortest:
+		logger.Warn("the interval is much shorter than the ttl of the records, a longer one saves requests", "interval", interval, "ttl", shortest)
+	case interval > longest*10:
+		logger.Warn("the interval is much longer than the ttl of the records, a shorter one publishes ip changes faster", "interval", interval, "ttl", longest)
+	}
+}
+
+// backoffInterval returns the interval to wait after the given number of
+// consecutive failed cycles, which doubles with every failure up to max.
+func backoffInterval(interval, max time.Duration, failures int) time.Duration {
+	d := interval
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		// the interval is never shortened by the backoff
+		if interval > max {
+			return interval
+		}
+		return max
+	}
+	return d
+}
+
+// jitter randomizes the given duration by up to the given fraction
+// in both directions, e.g. by up to ±10% for 0.1.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
+}
+
+// newHTTPClient returns the client sending the requests using the given
+// transport, which is configured by HTTP_TIMEOUT, USER_AGENT, MAX_RETRIES
+// and RETRY_DELAY.
+func newHTTPClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout: envDuration("HTTP_TIMEOUT", 30*time.Second),
+		Transport: &namedyn.RetryTransport{
+			Base: &namedyn.UserAgentTransport{
+				Base:      transport,
+				UserAgent: envString("USER_AGENT", defaultUserAgent()),
+			},
+			MaxRetries: envInt("MAX_RETRIES", 3),
+			Delay:      envDuration("RETRY_DELAY", time.Second),
+		},
+	}
 }
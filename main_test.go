@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		t.Setenv("HTTP_TIMEOUT", "")
+		os.Unsetenv("HTTP_TIMEOUT")
+		if cli := newHTTPClient(http.DefaultTransport); cli.Timeout != 30*time.Second {
+			t.Errorf("got timeout %v, want 30s", cli.Timeout)
+		}
+	})
+	t.Run("hanging server", func(t *testing.T) {
+		t.Setenv("HTTP_TIMEOUT", "50ms")
+		t.Setenv("MAX_RETRIES", "0")
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer srv.Close()
+		defer close(done)
+		cli := newHTTPClient(http.DefaultTransport)
+		if cli.Timeout != 50*time.Millisecond {
+			t.Errorf("got timeout %v, want 50ms", cli.Timeout)
+		}
+		start := time.Now()
+		_, err := cli.Get(srv.URL)
+		if err, ok := err.(net.Error); !ok || !err.Timeout() {
+			t.Fatalf("got error %v, want a timeout", err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("the request took %v, want it to be aborted after the timeout", d)
+		}
+	})
+}
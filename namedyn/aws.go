@@ -0,0 +1,73 @@
+package namedyn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// AWSCredentials are the credentials used to sign requests to aws apis.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsCredentialSource returns the given static credentials if they are complete,
+// otherwise the ones found by the default credential chain of the aws sdk, e.g.
+// the environment variables, a web identity token, the shared configuration and
+// credentials files, the container credentials of ecs or eks and the instance
+// role of ec2. The chain caches temporary credentials until they expire.
+type awsCredentialSource struct {
+	cli    Doer
+	static AWSCredentials
+	mu     sync.Mutex
+	chain  aws.CredentialsProvider
+}
+
+// Retrieve implements aws.CredentialsProvider, it returns the credentials
+// used to sign the next request.
+func (s *awsCredentialSource) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if s.static.AccessKeyID != "" && s.static.SecretAccessKey != "" {
+		return aws.Credentials{
+			AccessKeyID:     s.static.AccessKeyID,
+			SecretAccessKey: s.static.SecretAccessKey,
+			SessionToken:    s.static.SessionToken,
+			Source:          credentials.StaticCredentialsName,
+		}, nil
+	}
+	chain, err := s.defaultChain(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	c, err := chain.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("no aws credentials found: %s", err)
+	}
+	return c, nil
+}
+
+// defaultChain loads the credential chain on first use, so the configuration
+// files are only read if the static credentials are incomplete. Loading is
+// retried with the next request if it fails.
+func (s *awsCredentialSource) defaultChain(ctx context.Context) (aws.CredentialsProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chain != nil {
+		return s.chain, nil
+	}
+	// the region is only used by the chain itself, e.g. to request sts
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithHTTPClient(s.cli), config.WithDefaultRegion("us-east-1"))
+	if err != nil {
+		return nil, fmt.Errorf("error while loading the aws configuration: %s", err)
+	}
+	if cfg.Credentials == nil {
+		return nil, fmt.Errorf("no aws credentials found")
+	}
+	s.chain = cfg.Credentials
+	return s.chain, nil
+}
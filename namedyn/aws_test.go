@@ -0,0 +1,287 @@
+package namedyn
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// awsEnv are the environment variables used by the aws credential chain.
+var awsEnv = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+	"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_ENDPOINT_URL_STS", "AWS_REGION",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+	"AWS_EC2_METADATA_DISABLED", "AWS_EC2_METADATA_SERVICE_ENDPOINT", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL",
+	"AWS_CONFIG_FILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_DEFAULT_PROFILE", "AWS_SDK_LOAD_CONFIG", "AWS_CA_BUNDLE",
+}
+
+// clearAWSEnv unsets the environment variables of the aws credential chain
+// and lets the shared configuration and credentials files not exist.
+func clearAWSEnv(t *testing.T) {
+	for _, k := range awsEnv {
+		// t.Setenv restores the variable after the test
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+}
+
+// newAWSServer returns a server acting as sts, container credentials endpoint
+// and instance metadata service, which records the requests in calls.
+func newAWSServer(t *testing.T, calls *[]string) *httptest.Server {
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/" && r.Method == http.MethodPost:
+			r.ParseForm()
+			want := map[string]string{"Action": "AssumeRoleWithWebIdentity", "RoleArn": "arn:aws:iam::123456789012:role/dns", "RoleSessionName": "home", "WebIdentityToken": "jwt"}
+			for k, v := range want {
+				if got := r.PostForm.Get(k); got != v {
+					t.Errorf("got %s %q, want %q", k, got, v)
+				}
+			}
+			w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult><Credentials>` +
+				`<AccessKeyId>ASIAWEB</AccessKeyId><SecretAccessKey>web-secret</SecretAccessKey><SessionToken>web-session</SessionToken><Expiration>` + expiration + `</Expiration>` +
+				`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+		case r.URL.Path == "/container":
+			if got := r.Header.Get("Authorization"); got != "container-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"AccessKeyId":"ASIACONTAINER","SecretAccessKey":"container-secret","Token":"container-session","Expiration":"` + expiration + `"}`))
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+			w.Write([]byte("imds-token"))
+		case strings.HasPrefix(r.URL.Path, "/latest/meta-data/iam/security-credentials/"):
+			if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Path == "/latest/meta-data/iam/security-credentials/" {
+				w.Write([]byte("dns-role\n"))
+				return
+			}
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAINSTANCE","SecretAccessKey":"instance-secret","Token":"instance-session","Expiration":"` + expiration + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeFile writes the given content to a new file and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAWSCredentialSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		static AWSCredentials
+		// env returns the environment variables using the url of the server.
+		env   func(t *testing.T, url string) map[string]string
+		want  AWSCredentials
+		calls []string
+		err   string
+	}{
+		{
+			name:   "static",
+			static: AWSCredentials{AccessKeyID: "AKIASTATIC", SecretAccessKey: "static-secret"},
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "env-secret"}
+			},
+			want: AWSCredentials{AccessKeyID: "AKIASTATIC", SecretAccessKey: "static-secret"},
+		},
+		{
+			name:   "incomplete static",
+			static: AWSCredentials{AccessKeyID: "AKIASTATIC"},
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "env-secret", "AWS_SESSION_TOKEN": "env-session"}
+			},
+			want: AWSCredentials{AccessKeyID: "AKIAENV", SecretAccessKey: "env-secret", SessionToken: "env-session"},
+		},
+		{
+			name: "web identity",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{
+					"AWS_WEB_IDENTITY_TOKEN_FILE": writeFile(t, "token", "jwt"),
+					"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/dns",
+					"AWS_ROLE_SESSION_NAME":       "home",
+					"AWS_ENDPOINT_URL_STS":        url,
+				}
+			},
+			want:  AWSCredentials{AccessKeyID: "ASIAWEB", SecretAccessKey: "web-secret", SessionToken: "web-session"},
+			calls: []string{"POST /"},
+		},
+		{
+			name: "shared credentials file",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{
+					"AWS_SHARED_CREDENTIALS_FILE":        writeFile(t, "credentials", "[default]\naws_access_key_id = AKIAOTHER\naws_secret_access_key = other\n\n[dns]\naws_access_key_id = AKIAFILE\naws_secret_access_key = file-secret\n"),
+					"AWS_PROFILE":                        "dns",
+					"AWS_CONTAINER_CREDENTIALS_FULL_URI": url + "/container",
+				}
+			},
+			want: AWSCredentials{AccessKeyID: "AKIAFILE", SecretAccessKey: "file-secret"},
+		},
+		{
+			name: "profile without credentials",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_SHARED_CREDENTIALS_FILE": writeFile(t, "credentials", "[default]\nregion = eu-central-1\n"), "AWS_EC2_METADATA_DISABLED": "true"}
+			},
+			err: "no aws credentials found",
+		},
+		{
+			name: "container",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{
+					"AWS_CONTAINER_CREDENTIALS_FULL_URI":     url + "/container",
+					"AWS_CONTAINER_AUTHORIZATION_TOKEN":      "ignored",
+					"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE": writeFile(t, "token", "container-token"),
+				}
+			},
+			want:  AWSCredentials{AccessKeyID: "ASIACONTAINER", SecretAccessKey: "container-secret", SessionToken: "container-session"},
+			calls: []string{"GET /container"},
+		},
+		{
+			name: "container without authorization",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_CONTAINER_CREDENTIALS_FULL_URI": url + "/container"}
+			},
+			calls: []string{"GET /container"},
+			err:   "no aws credentials found",
+		},
+		{
+			name: "container on another host",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_CONTAINER_CREDENTIALS_FULL_URI": "http://example.com/container"}
+			},
+			err: "error while loading the aws configuration",
+		},
+		{
+			name: "instance metadata",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_EC2_METADATA_SERVICE_ENDPOINT": url}
+			},
+			want: AWSCredentials{AccessKeyID: "ASIAINSTANCE", SecretAccessKey: "instance-secret", SessionToken: "instance-session"},
+			calls: []string{
+				"PUT /latest/api/token",
+				"GET /latest/meta-data/iam/security-credentials/",
+				"GET /latest/meta-data/iam/security-credentials/dns-role",
+			},
+		},
+		{
+			name: "instance metadata disabled",
+			env: func(t *testing.T, url string) map[string]string {
+				return map[string]string{"AWS_EC2_METADATA_SERVICE_ENDPOINT": url, "AWS_EC2_METADATA_DISABLED": "true"}
+			},
+			err: "no aws credentials found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			srv := newAWSServer(t, &calls)
+			clearAWSEnv(t)
+			for k, v := range tt.env(t, srv.URL) {
+				t.Setenv(k, v)
+			}
+			s := &awsCredentialSource{cli: http.DefaultClient, static: tt.static}
+			got, err := s.Retrieve(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if c := (AWSCredentials{AccessKeyID: got.AccessKeyID, SecretAccessKey: got.SecretAccessKey, SessionToken: got.SessionToken}); c != tt.want {
+				t.Errorf("got %+v, want %+v", c, tt.want)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("got requests %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestAWSCredentialSourceCachesTemporaryCredentials(t *testing.T) {
+	var calls []string
+	srv := newAWSServer(t, &calls)
+	clearAWSEnv(t)
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", srv.URL)
+	s := &awsCredentialSource{cli: http.DefaultClient}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Retrieve(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(calls) != 3 {
+		t.Errorf("got requests %q, want the credentials to be requested once", calls)
+	}
+}
+
+func TestRoute53SignsRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		static AWSCredentials
+		// want are the prefix of the authorization header and the security token.
+		want  string
+		token string
+	}{
+		{
+			name:   "static",
+			static: AWSCredentials{AccessKeyID: "AKIASTATIC", SecretAccessKey: "static-secret"},
+			want:   "AWS4-HMAC-SHA256 Credential=AKIASTATIC/",
+		},
+		{
+			name:   "session token",
+			static: AWSCredentials{AccessKeyID: "ASIASTATIC", SecretAccessKey: "static-secret", SessionToken: "session"},
+			want:   "AWS4-HMAC-SHA256 Credential=ASIASTATIC/",
+			token:  "session",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auth, token string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth, token = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token")
+				w.Write([]byte(`<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ResourceRecordSets></ResourceRecordSets></ListResourceRecordSetsResponse>`))
+			}))
+			defer srv.Close()
+			p := NewRoute53Provider(srv.Client(), srv.URL, "/hostedzone/Z1", "example.com", tt.static)
+			if _, err := p.FindRecords(context.Background(), "home", "A"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// route 53 requests are signed for us-east-1
+			if !strings.HasPrefix(auth, tt.want) || !strings.Contains(auth, "/us-east-1/route53/aws4_request") {
+				t.Errorf("got authorization %q, want a signature of %q for route 53 in us-east-1", auth, tt.want)
+			}
+			if token != tt.token {
+				t.Errorf("got security token %q, want %q", token, tt.token)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package namedyn
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuit breaker.
+type breakerState int
+
+const (
+	// closed breakers let all requests pass.
+	closed breakerState = iota
+	// open breakers block all requests until the cooldown has passed.
+	open
+	// halfOpen breakers let a single request pass to test whether
+	// the provider has recovered.
+	halfOpen
+)
+
+// String returns the name of the state as used by the logs.
+func (s breakerState) String() string {
+	switch s {
+	case open:
+		return "open"
+	case halfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker is a circuit breaker pausing the requests to a provider after
+// threshold consecutive failures for the cooldown, so a failing api is not
+// hammered every cycle.
+type breaker struct {
+	provider  string
+	domain    string
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	opened    time.Time
+	// probing is set while the request testing the provider is running.
+	probing bool
+}
+
+// allow returns true if a record may be handled using the provider. Open
+// breakers become half-open once the cooldown has passed, they only allow
+// one record at a time until it is known whether the provider recovered.
+func (b *breaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == open && time.Since(b.opened) >= b.cooldown {
+		b.setState(halfOpen)
+		ctxLogger(ctx).Info("circuit breaker half-open, testing the provider", "provider", b.provider, "domain", b.domain)
+	}
+	switch b.state {
+	case open:
+		return false
+	case halfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record stores the outcome of handling a record allowed by the breaker.
+func (b *breaker) record(ctx context.Context, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		if b.state != closed {
+			ctxLogger(ctx).Info("circuit breaker closed, the provider recovered", "provider", b.provider, "domain", b.domain)
+			b.setState(closed)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == halfOpen || (b.state == closed && b.failures >= b.threshold) {
+		ctxLogger(ctx).Warn("circuit breaker opened, pausing requests to the provider", "provider", b.provider, "domain", b.domain, "failures", b.failures, "cooldown", b.cooldown)
+		b.setState(open)
+		b.opened = time.Now()
+	}
+}
+
+// setState changes the state of the breaker and exposes it as metric.
+func (b *breaker) setState(s breakerState) {
+	b.state = s
+	breakerStateGauge.set(float64(s), b.provider, b.domain)
+}
@@ -0,0 +1,202 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CloudDNSRecordSet represents the resource record set type from the google
+// cloud dns api (https://cloud.google.com/dns/docs/reference/v1/resourceRecordSets).
+type CloudDNSRecordSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int32    `json:"ttl"`
+	RRDatas []string `json:"rrdatas"`
+}
+
+// CloudDNSChange represents a change of resource record sets, which are
+// deleted and added atomically.
+type CloudDNSChange struct {
+	Additions []CloudDNSRecordSet `json:"additions,omitempty"`
+	Deletions []CloudDNSRecordSet `json:"deletions,omitempty"`
+}
+
+// CloudDNSProvider manages the records of a managed zone using the google cloud dns v1 api.
+type CloudDNSProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://dns.googleapis.com/dns/v1.
+	baseURL string
+	project string
+	zone    string
+	domain  string
+	tokens  *gcpTokenSource
+}
+
+// NewCloudDNSProvider returns a provider managing the records of the given
+// domain in the given managed zone of the given project using the cloud dns api
+// at baseURL. The requests are authorized by the application default credentials.
+func NewCloudDNSProvider(cli Doer, baseURL, project, zone, domain string) *CloudDNSProvider {
+	return &CloudDNSProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		project: project,
+		zone:    zone,
+		domain:  domain,
+		tokens:  &gcpTokenSource{cli: cli},
+	}
+}
+
+// do sends an authorized request to the given path of the managed zone
+// and decodes the reply into v. The operation is used by the metrics.
+func (p *CloudDNSProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	token, err := p.tokens.token(ctx)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/projects/%s/managedZones/%s%s", p.baseURL, p.project, p.zone, path), &buf)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("%w: the managed zone %s of project %s does not exist: %s", ErrDomainNotFound, p.zone, p.project, string(b))
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// FindRecords searches for the host records of the given type. Cloud DNS
+// manages all values of a record as one resource record set, so a record is
+// returned for every value, which is also used as its id.
+func (p *CloudDNSProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	rs, err := p.recordSet(ctx, host, typ)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing dns records using cloud dns api: %w", err)
+	}
+	if rs == nil {
+		return nil, nil
+	}
+	var records []*Record
+	for _, v := range rs.RRDatas {
+		records = append(records, &Record{
+			ID:     v,
+			Host:   host,
+			Type:   rs.Type,
+			Answer: rrsetAnswer(rs.Type, v),
+			TTL:    rs.TTL,
+		})
+	}
+	return records, nil
+}
+
+// recordSet returns the resource record set of the given host and type or nil if it does not exist.
+func (p *CloudDNSProvider) recordSet(ctx context.Context, host, typ string) (*CloudDNSRecordSet, error) {
+	q := url.Values{}
+	q.Set("name", p.name(host))
+	q.Set("type", typ)
+	var reply struct {
+		RRSets []CloudDNSRecordSet `json:"rrsets"`
+	}
+	if err := p.do(ctx, "list", http.MethodGet, "/rrsets?"+q.Encode(), nil, &reply); err != nil {
+		return nil, err
+	}
+	for i, rs := range reply.RRSets {
+		if strings.EqualFold(rs.Name, p.name(host)) && rs.Type == typ && len(rs.RRDatas) > 0 {
+			return &reply.RRSets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateRecord creates the given record.
+func (p *CloudDNSProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "create", rec, "", rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while creating dns record using cloud dns api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *CloudDNSProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "update", rec, rec.ID, rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while updating dns record using cloud dns api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *CloudDNSProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "delete", rec, rec.ID, ""); err != nil {
+		return fmt.Errorf("error while deleting dns record using cloud dns api: %s", err)
+	}
+	return nil
+}
+
+// change removes the value remove from the resource record set of the given
+// record and adds the value add, both are ignored if they are empty. The
+// current set is deleted and the new one, using the ttl of the record, is
+// added by a single change, so the update is atomic. The operation is used by
+// the metrics.
+func (p *CloudDNSProvider) change(ctx context.Context, operation string, rec *Record, remove, add string) error {
+	current, err := p.recordSet(ctx, rec.Host, rec.Type)
+	if err != nil {
+		return err
+	}
+	rs := CloudDNSRecordSet{Name: p.name(rec.Host), Type: rec.Type, TTL: rec.TTL}
+	var c CloudDNSChange
+	if current != nil {
+		// deleting a set requires its current values
+		c.Deletions = []CloudDNSRecordSet{*current}
+		for _, v := range current.RRDatas {
+			if v != remove && v != add {
+				rs.RRDatas = append(rs.RRDatas, v)
+			}
+		}
+	}
+	if add != "" {
+		rs.RRDatas = append(rs.RRDatas, add)
+	}
+	if len(rs.RRDatas) > 0 {
+		c.Additions = []CloudDNSRecordSet{rs}
+	}
+	if len(c.Additions) == 0 && len(c.Deletions) == 0 {
+		return nil
+	}
+	return p.do(ctx, operation, http.MethodPost, "/changes", c, nil)
+}
+
+// name returns the fully qualified name of the given host with
+// a trailing dot, as used by the cloud dns api.
+func (p *CloudDNSProvider) name(host string) string {
+	if host == "" {
+		return p.domain + "."
+	}
+	return fmt.Sprintf("%s.%s.", host, p.domain)
+}
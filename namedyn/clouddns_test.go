@@ -0,0 +1,183 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// cloudDNSServer is a mock of the cloud dns api and of the google token
+// endpoint managing the given record sets of the zone z of project p.
+type cloudDNSServer struct {
+	t       *testing.T
+	rrsets  []CloudDNSRecordSet
+	changes []CloudDNSChange
+}
+
+func (s *cloudDNSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/token" {
+		w.Write([]byte(`{"access_token":"secret","token_type":"Bearer","expires_in":3600}`))
+		return
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+		s.t.Errorf("got authorization %q, want the access token", got)
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/projects/p/managedZones/z/rrsets":
+		var rrsets []CloudDNSRecordSet
+		for _, rs := range s.rrsets {
+			if rs.Name == r.URL.Query().Get("name") && rs.Type == r.URL.Query().Get("type") {
+				rrsets = append(rrsets, rs)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"rrsets": rrsets})
+	case r.Method == http.MethodPost && r.URL.Path == "/projects/p/managedZones/z/changes":
+		var c CloudDNSChange
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			s.t.Errorf("could not decode change: %s", err)
+		}
+		s.changes = append(s.changes, c)
+		json.NewEncoder(w).Encode(c)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCloudDNSChanges(t *testing.T) {
+	current := CloudDNSRecordSet{Name: "home.example.com.", Type: "A", TTL: 300, RRDatas: []string{"203.0.113.1", "203.0.113.2"}}
+	tests := []struct {
+		name   string
+		rrsets []CloudDNSRecordSet
+		change func(p *CloudDNSProvider, rec *Record) error
+		want   []CloudDNSChange
+	}{
+		{
+			name: "create",
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				return p.CreateRecord(context.Background(), rec)
+			},
+			want: []CloudDNSChange{{Additions: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 60, RRDatas: []string{"203.0.113.9"}}}}},
+		},
+		{
+			name:   "create keeps the other values",
+			rrsets: []CloudDNSRecordSet{current},
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				return p.CreateRecord(context.Background(), rec)
+			},
+			want: []CloudDNSChange{{
+				Additions: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 60, RRDatas: []string{"203.0.113.1", "203.0.113.2", "203.0.113.9"}}},
+				Deletions: []CloudDNSRecordSet{current},
+			}},
+		},
+		{
+			name:   "update",
+			rrsets: []CloudDNSRecordSet{current},
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.UpdateRecord(context.Background(), rec)
+			},
+			want: []CloudDNSChange{{
+				Additions: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 60, RRDatas: []string{"203.0.113.2", "203.0.113.9"}}},
+				Deletions: []CloudDNSRecordSet{current},
+			}},
+		},
+		{
+			name:   "delete a value",
+			rrsets: []CloudDNSRecordSet{current},
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				rec.ID = "203.0.113.2"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+			want: []CloudDNSChange{{
+				Additions: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 60, RRDatas: []string{"203.0.113.1"}}},
+				Deletions: []CloudDNSRecordSet{current},
+			}},
+		},
+		{
+			name:   "delete the last value",
+			rrsets: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 300, RRDatas: []string{"203.0.113.1"}}},
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+			want: []CloudDNSChange{{Deletions: []CloudDNSRecordSet{{Name: "home.example.com.", Type: "A", TTL: 300, RRDatas: []string{"203.0.113.1"}}}}},
+		},
+		{
+			name: "delete a missing record",
+			change: func(p *CloudDNSProvider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &cloudDNSServer{t: t, rrsets: tt.rrsets}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			newGCPCredentials(t, srv.URL+"/token")
+			p := NewCloudDNSProvider(srv.Client(), srv.URL, "p", "z", "example.com")
+			rec := &Record{Host: "home", Type: "A", Answer: "203.0.113.9", TTL: 60}
+			if err := tt.change(p, rec); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(s.changes, tt.want) {
+				t.Errorf("got changes %+v, want %+v", s.changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudDNSCNAME(t *testing.T) {
+	s := &cloudDNSServer{t: t, rrsets: []CloudDNSRecordSet{{Name: "www.example.com.", Type: "CNAME", TTL: 300, RRDatas: []string{"old.example.net."}}}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	newGCPCredentials(t, srv.URL+"/token")
+	p := NewCloudDNSProvider(srv.Client(), srv.URL, "p", "z", "example.com")
+	records, err := p.FindRecords(context.Background(), "www", "CNAME")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(records) != 1 || records[0].Answer != "old.example.net" {
+		t.Fatalf("got records %+v, want one pointing to old.example.net", records)
+	}
+	rec := records[0]
+	rec.Answer = "target.example.net"
+	if err := p.UpdateRecord(context.Background(), rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// cloud dns requires the targets to be fully qualified
+	want := []CloudDNSChange{{
+		Additions: []CloudDNSRecordSet{{Name: "www.example.com.", Type: "CNAME", TTL: 300, RRDatas: []string{"target.example.net."}}},
+		Deletions: []CloudDNSRecordSet{{Name: "www.example.com.", Type: "CNAME", TTL: 300, RRDatas: []string{"old.example.net."}}},
+	}}
+	if !reflect.DeepEqual(s.changes, want) {
+		t.Errorf("got changes %+v, want %+v", s.changes, want)
+	}
+}
+
+func TestCloudDNSFindRecords(t *testing.T) {
+	s := &cloudDNSServer{t: t, rrsets: []CloudDNSRecordSet{
+		{Name: "home.example.com.", Type: "TXT", TTL: 300, RRDatas: []string{`"a b"`, `"c"`}},
+		{Name: "home.example.com.", Type: "A", TTL: 300, RRDatas: []string{"203.0.113.1"}},
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	newGCPCredentials(t, srv.URL+"/token")
+	p := NewCloudDNSProvider(srv.Client(), srv.URL, "p", "z", "example.com")
+	got, err := p.FindRecords(context.Background(), "home", "TXT")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []*Record{
+		{ID: `"a b"`, Host: "home", Type: "TXT", Answer: "a b", TTL: 300},
+		{ID: `"c"`, Host: "home", Type: "TXT", Answer: "c", TTL: 300},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got records %+v, want %+v", got, want)
+	}
+}
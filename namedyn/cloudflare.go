@@ -0,0 +1,278 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CloudflareRecord represents the dns record type from the cloudflare api
+// (https://api.cloudflare.com/#dns-records-for-a-zone-properties).
+type CloudflareRecord struct {
+	Id      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int32  `json:"ttl"`
+	// Proxied is only supported by A, AAAA and CNAME records.
+	Proxied *bool `json:"proxied,omitempty"`
+}
+
+// CloudflareReply represents the envelope of all replies from the cloudflare api.
+type CloudflareReply struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage      `json:"result"`
+	ResultInfo CloudflareResultInfo `json:"result_info"`
+}
+
+// CloudflareResultInfo represents the pagination of replies listing records.
+type CloudflareResultInfo struct {
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
+}
+
+// CloudflareProvider manages the records of a zone using the cloudflare v4 api.
+type CloudflareProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.cloudflare.com/client/v4.
+	baseURL string
+	token   string
+	domain  string
+	proxied bool
+	// zoneID is looked up by the domain name if it is empty.
+	zoneID string
+	mu     sync.Mutex
+}
+
+// NewCloudflareProvider returns a provider managing the records of the given
+// domain using the cloudflare api at baseURL and the given api token. If zoneID is empty, the zone
+// is looked up by the domain name. The proxied flag is set on all A, AAAA and
+// CNAME records created or updated by the provider.
+func NewCloudflareProvider(cli Doer, baseURL, token, domain, zoneID string, proxied bool) *CloudflareProvider {
+	return &CloudflareProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		domain:  domain,
+		zoneID:  zoneID,
+		proxied: proxied,
+	}
+}
+
+// request sends an authenticated request to the given path of the cloudflare
+// api and returns its successful reply. The operation is used by the metrics.
+func (p *CloudflareProvider) request(ctx context.Context, operation, method, path string, body interface{}) (*CloudflareReply, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if unauthorized(res) {
+		b, _ := readBody(res.Body)
+		return nil, fmt.Errorf("%w with status code %v: %s", ErrUnauthorized, res.StatusCode, string(b))
+	}
+	var reply CloudflareReply
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("could not decode the reply with status code %v: %s", res.StatusCode, err)
+	}
+	if !successful(res) || !reply.Success {
+		return nil, fmt.Errorf("unexpected status code %v: %+v", res.StatusCode, reply.Errors)
+	}
+	return &reply, nil
+}
+
+// do sends a request like request and decodes the result of the reply into v.
+func (p *CloudflareProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	reply, err := p.request(ctx, operation, method, path, body)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.Unmarshal(reply.Result, v); err != nil {
+			return fmt.Errorf("could not decode the result: %s", err)
+		}
+	}
+	return nil
+}
+
+// zone returns the id of the zone, looking it up if necessary.
+func (p *CloudflareProvider) zone(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.zoneID != "" {
+		return p.zoneID, nil
+	}
+	var zones []struct {
+		Id string `json:"id"`
+	}
+	if err := p.do(ctx, "list", http.MethodGet, "/zones?name="+url.QueryEscape(p.domain), nil, &zones); err != nil {
+		return "", fmt.Errorf("error while looking up cloudflare zone of %s: %w", p.domain, err)
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("%w: could not find cloudflare zone of %s", ErrDomainNotFound, p.domain)
+	}
+	p.zoneID = zones[0].Id
+	return p.zoneID, nil
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *CloudflareProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("type", typ)
+	q.Set("name", p.name(host))
+	q.Set("per_page", "100")
+	var found []*Record
+	// the records are paginated, so all pages
+	// are requested until the record is found
+	for page := 1; ; page++ {
+		q.Set("page", strconv.Itoa(page))
+		reply, err := p.request(ctx, "list", http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?%s", zone, q.Encode()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error while listing dns records using cloudflare api: %w", err)
+		}
+		var records []CloudflareRecord
+		if err := json.Unmarshal(reply.Result, &records); err != nil {
+			return nil, fmt.Errorf("error while listing dns records using cloudflare api: could not decode the result: %s", err)
+		}
+		for _, r := range records {
+			rec := &Record{
+				ID:     r.Id,
+				Host:   host,
+				Type:   r.Type,
+				Answer: r.Content,
+				TTL:    r.TTL,
+			}
+			// cloudflare reports other records as not proxied
+			if proxiable(r.Type) && r.Proxied != nil {
+				rec.Options = map[string]string{"proxied": strconv.FormatBool(*r.Proxied)}
+			}
+			found = append(found, rec)
+		}
+		if page >= reply.ResultInfo.TotalPages {
+			return found, nil
+		}
+	}
+}
+
+// CreateRecord creates the given record.
+func (p *CloudflareProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return err
+	}
+	var created CloudflareRecord
+	if err := p.do(ctx, "create", http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", zone), p.cloudflareRecord(rec), &created); err != nil {
+		return fmt.Errorf("error while creating dns record using cloudflare api: %s", err)
+	}
+	rec.ID = created.Id
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *CloudflareProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.do(ctx, "update", http.MethodPut, fmt.Sprintf("/zones/%s/dns_records/%s", zone, rec.ID), p.cloudflareRecord(rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using cloudflare api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *CloudflareProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.do(ctx, "delete", http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", zone, rec.ID), nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using cloudflare api: %s", err)
+	}
+	return nil
+}
+
+// name returns the fully qualified name of the given host,
+// as cloudflare does not use names relative to the zone.
+func (p *CloudflareProvider) name(host string) string {
+	if host == "" {
+		return p.domain
+	}
+	return fmt.Sprintf("%s.%s", host, p.domain)
+}
+
+// proxiable returns true if records of the given type can be proxied by cloudflare.
+func proxiable(typ string) bool {
+	return typ == "A" || typ == "AAAA" || typ == "CNAME"
+}
+
+// isProxied returns true if records with the given options are proxied. The
+// proxied option takes precedence over the proxied flag.
+func (p *CloudflareProvider) isProxied(options map[string]string) bool {
+	if v, err := strconv.ParseBool(options["proxied"]); err == nil {
+		return v
+	}
+	return p.proxied
+}
+
+// applied returns the ttl and the options cloudflare applies to records of the
+// given type created or updated with the given ones. Proxied records always use
+// the automatic ttl 1 and the proxied option defaults to the proxied flag.
+func (p *CloudflareProvider) applied(typ string, ttl int32, options map[string]string) (int32, map[string]string) {
+	if !proxiable(typ) {
+		return ttl, options
+	}
+	proxied := p.isProxied(options)
+	applied := make(map[string]string, len(options)+1)
+	for k, v := range options {
+		applied[k] = v
+	}
+	applied["proxied"] = strconv.FormatBool(proxied)
+	if proxied {
+		ttl = 1
+	}
+	return ttl, applied
+}
+
+// cloudflareRecord converts the given record to a cloudflare record.
+func (p *CloudflareProvider) cloudflareRecord(rec *Record) *CloudflareRecord {
+	r := &CloudflareRecord{
+		Id:      rec.ID,
+		Type:    rec.Type,
+		Name:    p.name(rec.Host),
+		Content: rec.Answer,
+		TTL:     rec.TTL,
+	}
+	// cloudflare rejects the proxied flag of other records
+	if proxiable(rec.Type) {
+		proxied := p.isProxied(rec.Options)
+		r.Proxied = &proxied
+	}
+	return r
+}
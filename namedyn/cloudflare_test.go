@@ -0,0 +1,180 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// boolPointer returns a pointer to the given value.
+func boolPointer(b bool) *bool {
+	return &b
+}
+
+// cloudflareServer is a mock of the cloudflare api listing the given records
+// of the zone with the id zone.
+type cloudflareServer struct {
+	records []CloudflareRecord
+	// pages contains the records of the pages, which replace records if set.
+	pages [][]CloudflareRecord
+	// requests contains the method, path and body of all requests.
+	requests []string
+}
+
+func (s *cloudflareServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.requests = append(s.requests, strings.TrimSpace(fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, b)))
+	reply := map[string]interface{}{"success": true, "result": s.records}
+	if r.Method != http.MethodGet {
+		var rec CloudflareRecord
+		json.Unmarshal(b, &rec)
+		rec.Id = "new"
+		reply["result"] = rec
+	} else if s.pages != nil {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		reply["result"] = s.pages[page-1]
+		reply["result_info"] = map[string]int{"page": page, "total_pages": len(s.pages)}
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+func TestCycleCloudflareProxied(t *testing.T) {
+	list := "GET /zones/zone/dns_records"
+	tests := []struct {
+		name    string
+		proxied bool
+		options map[string]string
+		records []CloudflareRecord
+		// requests contains the expected requests besides the list request.
+		requests []string
+	}{
+		{
+			name:    "proxied record with automatic ttl",
+			proxied: true,
+			records: []CloudflareRecord{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 1, Proxied: boolPointer(true)}},
+		},
+		{
+			name:    "proxied by option",
+			options: map[string]string{"proxied": "true"},
+			records: []CloudflareRecord{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 1, Proxied: boolPointer(true)}},
+		},
+		{
+			name:     "record not proxied",
+			proxied:  true,
+			records:  []CloudflareRecord{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 300}},
+			requests: []string{`PUT /zones/zone/dns_records/1 {"id":"1","type":"A","name":"home.example.com","content":"203.0.113.1","ttl":1,"proxied":true}`},
+		},
+		{
+			name:     "record proxied",
+			records:  []CloudflareRecord{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 1, Proxied: boolPointer(true)}},
+			requests: []string{`PUT /zones/zone/dns_records/1 {"id":"1","type":"A","name":"home.example.com","content":"203.0.113.1","ttl":300,"proxied":false}`},
+		},
+		{
+			name:     "not proxied by option",
+			proxied:  true,
+			options:  map[string]string{"proxied": "false"},
+			records:  []CloudflareRecord{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 1, Proxied: boolPointer(true)}},
+			requests: []string{`PUT /zones/zone/dns_records/1 {"id":"1","type":"A","name":"home.example.com","content":"203.0.113.1","ttl":300,"proxied":false}`},
+		},
+		{
+			name:     "create proxied record",
+			proxied:  true,
+			requests: []string{`POST /zones/zone/dns_records {"type":"A","name":"home.example.com","content":"203.0.113.1","ttl":1,"proxied":true}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &cloudflareServer{records: tt.records}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			p := NewCloudflareProvider(srv.Client(), srv.URL, "token", "example.com", "zone", tt.proxied)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p, Options: tt.options}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			want := append([]string{list}, tt.requests...)
+			if !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("got requests %q, want %q", s.requests, want)
+			}
+			// the applied settings match the configured ones, so the
+			// records are not looked up again until the next resync
+			if u.Cycle(context.Background()); len(s.requests) != len(want) {
+				t.Errorf("got requests %q after the second cycle, want %q", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestCycleCloudflareNotProxiable(t *testing.T) {
+	list := "GET /zones/zone/dns_records"
+	tests := []struct {
+		name    string
+		records []CloudflareRecord
+		// requests contains the expected requests of each cycle.
+		requests []string
+	}{
+		{
+			name:     "record reported as not proxied",
+			records:  []CloudflareRecord{{Id: "1", Type: "TXT", Name: "home.example.com", Content: "value", TTL: 300, Proxied: boolPointer(false)}},
+			requests: []string{list},
+		},
+		{
+			name:     "create record without proxied flag",
+			requests: []string{list, `POST /zones/zone/dns_records {"type":"TXT","name":"home.example.com","content":"value","ttl":300}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &cloudflareServer{records: tt.records}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			p := NewCloudflareProvider(srv.Client(), srv.URL, "token", "example.com", "zone", true)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "TXT", Target: "value", TTL: 300, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, nil)
+			// the records are looked up again by the second cycle
+			u.Resync = 0
+			var want []string
+			for i := 0; i < 2; i++ {
+				if !u.Cycle(context.Background()) {
+					t.Fatal("cycle failed")
+				}
+				want = append(want, tt.requests...)
+			}
+			if !reflect.DeepEqual(s.requests, want) {
+				t.Errorf("got requests %q, want %q", s.requests, want)
+			}
+		})
+	}
+}
+
+func TestCloudflareFindRecordsPages(t *testing.T) {
+	s := &cloudflareServer{pages: [][]CloudflareRecord{
+		{{Id: "1", Type: "A", Name: "home.example.com", Content: "203.0.113.1", TTL: 300, Proxied: boolPointer(false)}},
+		{{Id: "2", Type: "A", Name: "home.example.com", Content: "203.0.113.2", TTL: 1, Proxied: boolPointer(true)}},
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	p := NewCloudflareProvider(srv.Client(), srv.URL, "token", "example.com", "zone", false)
+	got, err := p.FindRecords(context.Background(), "home", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []*Record{
+		{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300, Options: map[string]string{"proxied": "false"}},
+		{ID: "2", Host: "home", Type: "A", Answer: "203.0.113.2", TTL: 1, Options: map[string]string{"proxied": "true"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got records %+v, want %+v", got, want)
+	}
+	if len(s.requests) != 2 {
+		t.Errorf("got requests %q, want both pages to be requested", s.requests)
+	}
+}
@@ -0,0 +1,57 @@
+package namedyn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CommandNotifier runs a shell command whenever a record has been created or updated.
+type CommandNotifier struct {
+	command string
+	timeout time.Duration
+}
+
+// NewCommandNotifier returns a notifier running the given command using sh,
+// which gets killed if it is still running after the given timeout.
+func NewCommandNotifier(command string, timeout time.Duration) *CommandNotifier {
+	return &CommandNotifier{
+		command: command,
+		timeout: timeout,
+	}
+}
+
+// Notify runs the command for the given change, which is passed by the
+// environment variables NAMEDYN_HOST, NAMEDYN_TYPE, NAMEDYN_OLD_IP and
+// NAMEDYN_NEW_IP. The output of the command is logged. Deleted records
+// are ignored.
+func (n *CommandNotifier) Notify(ctx context.Context, c Change) error {
+	if c.NewIP == "" {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx, n.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.command)
+	cmd.Env = append(os.Environ(),
+		"NAMEDYN_HOST="+c.Host,
+		"NAMEDYN_TYPE="+c.Type,
+		"NAMEDYN_OLD_IP="+c.OldIP,
+		"NAMEDYN_NEW_IP="+c.NewIP,
+	)
+	// children of the shell may keep the output open after it has been killed
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if s := strings.TrimSpace(string(out)); s != "" {
+		ctxLogger(ctx).Info("change command output", "host", c.Host, "type", c.Type, "output", s)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("change command timed out after %s", n.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("change command failed: %s", err)
+	}
+	return nil
+}
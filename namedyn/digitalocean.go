@@ -0,0 +1,177 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DigitalOceanRecord represents the domain record type from the digitalocean api
+// (https://docs.digitalocean.com/reference/api/api-reference/#tag/Domain-Records).
+type DigitalOceanRecord struct {
+	Id   int64  `json:"id,omitempty"`
+	Type string `json:"type"`
+	// Name is relative to the domain, the root record is named @.
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int32  `json:"ttl"`
+}
+
+// DigitalOceanListReply represents the reply while listing
+// records using the digitalocean api.
+type DigitalOceanListReply struct {
+	DomainRecords []DigitalOceanRecord `json:"domain_records"`
+	Links         struct {
+		Pages struct {
+			Next string `json:"next"`
+		} `json:"pages"`
+	} `json:"links"`
+}
+
+// DigitalOceanProvider manages the records of a domain using the digitalocean v2 api.
+type DigitalOceanProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.digitalocean.com/v2.
+	baseURL string
+	token   string
+	domain  string
+}
+
+// NewDigitalOceanProvider returns a provider managing the records of the given
+// domain using the digitalocean api at baseURL and the given api token.
+func NewDigitalOceanProvider(cli Doer, baseURL, token, domain string) *DigitalOceanProvider {
+	return &DigitalOceanProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		domain:  domain,
+	}
+}
+
+// do sends an authenticated request to the given path of the domain's records
+// and decodes the reply into v. The operation is used by the metrics.
+func (p *DigitalOceanProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/domains/%s/records%s", p.baseURL, p.domain, path), &buf)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *DigitalOceanProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	// the records are paginated, so all pages
+	// need to be queried to find all records
+	var records []*Record
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("type", typ)
+		// the name filter requires the fully qualified name
+		q.Set("name", p.fqdn(host))
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", "200")
+		var reply DigitalOceanListReply
+		if err := p.do(ctx, "list", http.MethodGet, "?"+q.Encode(), nil, &reply); err != nil {
+			return nil, fmt.Errorf("error while listing dns records using digitalocean api: %w", err)
+		}
+		for _, r := range reply.DomainRecords {
+			if r.Name == p.name(host) && r.Type == typ {
+				records = append(records, r.record(host))
+			}
+		}
+		if reply.Links.Pages.Next == "" {
+			return records, nil
+		}
+	}
+}
+
+// CreateRecord creates the given record.
+func (p *DigitalOceanProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	var reply struct {
+		DomainRecord DigitalOceanRecord `json:"domain_record"`
+	}
+	if err := p.do(ctx, "create", http.MethodPost, "", p.digitalOceanRecord(rec), &reply); err != nil {
+		return fmt.Errorf("error while creating dns record using digitalocean api: %s", err)
+	}
+	rec.ID = strconv.FormatInt(reply.DomainRecord.Id, 10)
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *DigitalOceanProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if err := p.do(ctx, "update", http.MethodPut, "/"+rec.ID, p.digitalOceanRecord(rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using digitalocean api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *DigitalOceanProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.do(ctx, "delete", http.MethodDelete, "/"+rec.ID, nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using digitalocean api: %s", err)
+	}
+	return nil
+}
+
+// name returns the name of the given host as used by digitalocean.
+func (p *DigitalOceanProvider) name(host string) string {
+	if host == "" {
+		return "@"
+	}
+	return host
+}
+
+// fqdn returns the fully qualified name of the given host.
+func (p *DigitalOceanProvider) fqdn(host string) string {
+	if host == "" {
+		return p.domain
+	}
+	return fmt.Sprintf("%s.%s", host, p.domain)
+}
+
+// digitalOceanRecord converts the given record to a digitalocean record.
+func (p *DigitalOceanProvider) digitalOceanRecord(rec *Record) *DigitalOceanRecord {
+	return &DigitalOceanRecord{
+		Type: rec.Type,
+		Name: p.name(rec.Host),
+		Data: rec.Answer,
+		TTL:  rec.TTL,
+	}
+}
+
+// record converts the digitalocean record to a provider independent record.
+func (r *DigitalOceanRecord) record(host string) *Record {
+	return &Record{
+		ID:     strconv.FormatInt(r.Id, 10),
+		Host:   host,
+		Type:   r.Type,
+		Answer: r.Data,
+		TTL:    r.TTL,
+	}
+}
@@ -0,0 +1,210 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// digitalOceanAPI returns a mock of the digitalocean api managing the records of example.com on the given pages.
+func digitalOceanAPI(pages ...[]DigitalOceanRecord) *apiServer {
+	return &apiServer{
+		auth:   headerAuth("Authorization", "Bearer token", `{"id":"unauthorized","message":"Unable to authenticate you."}`),
+		failed: `{"id":"failed","message":"failed"}`,
+		handle: func(w http.ResponseWriter, r *http.Request, b []byte) {
+			switch r.Method {
+			case http.MethodGet:
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				var reply DigitalOceanListReply
+				if page >= 1 && page <= len(pages) {
+					reply.DomainRecords = pages[page-1]
+				}
+				if page < len(pages) {
+					reply.Links.Pages.Next = fmt.Sprintf("https://api.digitalocean.com/v2/domains/example.com/records?page=%v", page+1)
+				}
+				json.NewEncoder(w).Encode(reply)
+			case http.MethodPost:
+				var rec DigitalOceanRecord
+				json.Unmarshal(b, &rec)
+				rec.Id = 3
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]interface{}{"domain_record": rec})
+			case http.MethodPut:
+				w.Write(b)
+			case http.MethodDelete:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		},
+	}
+}
+
+func TestDigitalOceanFindRecords(t *testing.T) {
+	list := "GET /v2/domains/example.com/records?name=home.example.com&page=%v&per_page=200&type=A"
+	tests := []struct {
+		name     string
+		s        *apiServer
+		token    string
+		host     string
+		want     []*Record
+		requests []string
+		err      error
+	}{
+		{
+			name: "record",
+			s: digitalOceanAPI([]DigitalOceanRecord{
+				{Id: 1, Type: "A", Name: "home", Data: "203.0.113.1", TTL: 300},
+				{Id: 2, Type: "A", Name: "nas", Data: "203.0.113.2", TTL: 300},
+			}),
+			host:     "home",
+			want:     []*Record{{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{fmt.Sprintf(list, 1)},
+		},
+		{
+			name: "record on second page",
+			s: digitalOceanAPI(
+				[]DigitalOceanRecord{{Id: 1, Type: "A", Name: "nas", Data: "203.0.113.2", TTL: 300}},
+				[]DigitalOceanRecord{{Id: 2, Type: "A", Name: "home", Data: "203.0.113.1", TTL: 600}},
+			),
+			host:     "home",
+			want:     []*Record{{ID: "2", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600}},
+			requests: []string{fmt.Sprintf(list, 1), fmt.Sprintf(list, 2)},
+		},
+		{
+			name:     "root record",
+			s:        digitalOceanAPI([]DigitalOceanRecord{{Id: 1, Type: "A", Name: "@", Data: "203.0.113.1", TTL: 300}}),
+			want:     []*Record{{ID: "1", Host: "", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{"GET /v2/domains/example.com/records?name=example.com&page=1&per_page=200&type=A"},
+		},
+		{
+			name:     "not found",
+			s:        digitalOceanAPI(),
+			host:     "home",
+			requests: []string{fmt.Sprintf(list, 1)},
+		},
+		{
+			name:     "unauthorized",
+			s:        digitalOceanAPI(),
+			token:    "wrong",
+			host:     "home",
+			requests: []string{fmt.Sprintf(list, 1)},
+			err:      ErrUnauthorized,
+		},
+		{
+			name:     "server error",
+			s:        digitalOceanAPI().fail(http.MethodGet, http.StatusInternalServerError),
+			host:     "home",
+			requests: []string{fmt.Sprintf(list, 1)},
+			err:      errors.New("error while listing dns records using digitalocean api: unexpected status code 500"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = "token"
+			}
+			srv := tt.s.start(t)
+			p := NewDigitalOceanProvider(srv.Client(), srv.URL+"/v2/", token, "example.com")
+			got, err := p.FindRecords(context.Background(), tt.host, "A")
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestDigitalOceanChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *apiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		id       string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			s:        digitalOceanAPI(),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "3",
+			requests: []string{`POST /v2/domains/example.com/records {"type":"A","name":"home","data":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "create root record",
+			s:        digitalOceanAPI(),
+			op:       "create",
+			rec:      Record{Host: "", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "3",
+			requests: []string{`POST /v2/domains/example.com/records {"type":"A","name":"@","data":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "update",
+			s:        digitalOceanAPI(),
+			op:       "update",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{`PUT /v2/domains/example.com/records/1 {"type":"A","name":"home","data":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "delete",
+			s:        digitalOceanAPI(),
+			op:       "delete",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{"DELETE /v2/domains/example.com/records/1"},
+		},
+		{
+			name:     "update rejected",
+			s:        digitalOceanAPI().fail(http.MethodPut, http.StatusUnprocessableEntity),
+			op:       "update",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{`PUT /v2/domains/example.com/records/1 {"type":"A","name":"home","data":"203.0.113.1","ttl":300}`},
+			err:      errors.New(`error while updating dns record using digitalocean api: unexpected status code 422: {"id":"failed","message":"failed"}`),
+		},
+		{
+			name:     "delete forbidden",
+			s:        digitalOceanAPI().fail(http.MethodDelete, http.StatusForbidden),
+			op:       "delete",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{"DELETE /v2/domains/example.com/records/1"},
+			err:      errors.New("error while deleting dns record using digitalocean api: the credentials have been rejected with status code 403"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.s.start(t)
+			p := NewDigitalOceanProvider(srv.Client(), srv.URL+"/v2/", "token", "example.com")
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+// Package namedyn keeps dynamic dns records pointing to the own public ip,
+// it contains the providers, ip sources and notifiers used by the namedyn
+// command, which allows to embed the updates into other programs.
+//
+// An Updater manages the records of the given entries, the own public ips
+// are looked up using one IPFamily per record type:
+//
+//	p := namedyn.NewCloudflareProvider(http.DefaultClient, "https://api.cloudflare.com/client/v4", token, "example.com", "", false)
+//	entries := []namedyn.Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+//	families := []namedyn.IPFamily{{Type: "A", Sources: []string{"https://api.ipify.org?format=text"}}}
+//	u := namedyn.NewUpdater(http.DefaultClient, entries, families)
+//	ok := u.Cycle(ctx)
+package namedyn
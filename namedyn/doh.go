@@ -0,0 +1,165 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// dohSource describes a dns query sent using dns over https (rfc 8484)
+// returning the public ip of the client in a txt record.
+type dohSource struct {
+	// urls contains the url of the resolver by record type, the requests
+	// need to reach them using the address family of the record type.
+	urls  map[string]string
+	name  string
+	class uint16
+}
+
+// dohSources contains the supported dns over https sources by name.
+var dohSources = map[string]dohSource{
+	"cloudflare": {
+		// the certificates of the resolvers are valid for their ips
+		urls:  map[string]string{"A": "https://1.1.1.1/dns-query", "AAAA": "https://[2606:4700:4700::1111]/dns-query"},
+		name:  "whoami.cloudflare",
+		class: 3, // chaos
+	},
+}
+
+// lookupDoHIP queries the dns over https source with the given name to lookup
+// the own public ip, which is useful if plain dns queries are blocked. The name
+// may also be the url of a resolver answering the query of cloudflare.
+func lookupDoHIP(ctx context.Context, cli Doer, name, typ string) (string, error) {
+	src, ok := dohSources[name]
+	u := src.urls[typ]
+	if strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://") {
+		src, u = dohSources["cloudflare"], name
+	} else if !ok {
+		return "", fmt.Errorf("unknown dns over https source %s", name)
+	}
+	// the query is posted, but has no side effects and can be retried safely
+	req, err := http.NewRequestWithContext(withIdempotent(ctx), http.MethodPost, u, bytes.NewReader(dnsQuery(src.name, 16, src.class)))
+	if err != nil {
+		return "", fmt.Errorf("error while creating request to %s: %s", u, err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	res, err := timedDo(cli, "ip", req)
+	if err != nil {
+		return "", fmt.Errorf("error while querying %s to lookup own ip: %s", u, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		b, _ := readBody(res.Body)
+		return "", fmt.Errorf("unexpected status code %v while looking up own ip using %s: %s", res.StatusCode, u, string(b))
+	}
+	// dns messages are limited to 64 KiB
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err != nil {
+		return "", fmt.Errorf("error while reading response body from %s: %s", u, err)
+	}
+	txts, err := dnsTXTAnswers(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid reply from %s: %s", u, err)
+	}
+	for _, t := range txts {
+		if ip, err := validateIP(t, typ); err == nil {
+			return ip, nil
+		}
+	}
+	return "", fmt.Errorf("%s did not return a valid ip for %s", u, src.name)
+}
+
+// dnsQuery returns a dns message querying the records of the given name,
+// type and class. The id is 0 as recommended for dns over https.
+func dnsQuery(name string, typ, class uint16) []byte {
+	// header with the recursion desired flag and a single question
+	b := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, typ)
+	return binary.BigEndian.AppendUint16(b, class)
+}
+
+// dnsTXTAnswers returns the strings of the txt records in the answer section
+// of the given dns message, multiple strings of a record are joined.
+func dnsTXTAnswers(msg []byte) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("the message is too short")
+	}
+	if rcode := msg[3] & 0x0f; rcode != 0 {
+		return nil, fmt.Errorf("the query failed with rcode %v", rcode)
+	}
+	questions := binary.BigEndian.Uint16(msg[4:])
+	answers := binary.BigEndian.Uint16(msg[6:])
+	off := 12
+	var err error
+	for i := 0; i < int(questions); i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		// type and class
+		off += 4
+	}
+	var txts []string
+	for i := 0; i < int(answers); i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		// type, class, ttl and length of the data
+		if off+10 > len(msg) {
+			return nil, errors.New("the message is truncated")
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		n := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+n > len(msg) {
+			return nil, errors.New("the message is truncated")
+		}
+		data := msg[off : off+n]
+		off += n
+		if typ != 16 {
+			continue
+		}
+		// the data consists of strings prefixed by their length
+		var s strings.Builder
+		for len(data) > 0 {
+			l := int(data[0])
+			if 1+l > len(data) {
+				return nil, errors.New("invalid txt record")
+			}
+			s.Write(data[1 : 1+l])
+			data = data[1+l:]
+		}
+		txts = append(txts, s.String())
+	}
+	return txts, nil
+}
+
+// skipDNSName returns the offset following the possibly compressed
+// name starting at the given offset of the dns message.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errors.New("the message is truncated")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			// a pointer to a name elsewhere in the message ends the name
+			return off + 2, nil
+		}
+		off += 1 + l
+	}
+}
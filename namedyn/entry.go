@@ -0,0 +1,68 @@
+package namedyn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entry is a record managed by the updater.
+type Entry struct {
+	// Host is relative to the domain, it is empty for the root record.
+	Host   string
+	Domain string
+	Type   string
+	// Target is the static answer of records not pointing to the own public
+	// ip, e.g. the target of a CNAME, the value of a TXT or the address of
+	// a static A record or the mail server of an MX record or the
+	// host providing the service of an SRV record.
+	Target string
+	TTL    int32
+	// Priority is the preference of MX and SRV records.
+	Priority int32
+	// Weight and Port are only used by SRV records.
+	Weight   int32
+	Port     int32
+	Provider Provider
+	// Optional records are skipped if there is no own public ip
+	// of their type, e.g. AAAA records without ipv6 connectivity.
+	Optional bool
+	// Options are passed to the provider with the created or updated records.
+	Options map[string]string
+}
+
+// Hostname returns the fully qualified name of the entry's record.
+func (e Entry) Hostname() string {
+	if e.Host == "" {
+		return e.Domain
+	}
+	return fmt.Sprintf("%s.%s", e.Host, e.Domain)
+}
+
+// settings returns the ttl and the options applied to the entry's records by its provider.
+func (e Entry) settings() (int32, map[string]string) {
+	if a, ok := e.Provider.(settingsApplier); ok {
+		return a.applied(e.Type, e.TTL, e.Options)
+	}
+	return e.TTL, e.Options
+}
+
+// IsIPType returns true if records of the given type point to the own public ip.
+func IsIPType(typ string) bool {
+	return typ == "A" || typ == "AAAA"
+}
+
+// hostnameType returns true if the answers of records of the given type
+// are hostnames, e.g. the target of a CNAME or the mail server of an MX.
+func hostnameType(typ string) bool {
+	return typ == "CNAME" || typ == "MX" || typ == "SRV"
+}
+
+// NormalizeAnswer returns the given answer of a record of the given type as it
+// is compared by the updater. Hostnames are lower case without a trailing dot,
+// as some providers return them fully qualified, e.g. target.example.net.
+func NormalizeAnswer(typ, answer string) string {
+	if !hostnameType(typ) {
+		return answer
+	}
+	return strings.ToLower(strings.TrimSuffix(answer, "."))
+}
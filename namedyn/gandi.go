@@ -0,0 +1,207 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GandiRecordSet represents the record type from the gandi livedns api
+// (https://api.gandi.net/docs/livedns/), which contains all values of a name and type.
+type GandiRecordSet struct {
+	Name   string   `json:"rrset_name,omitempty"`
+	Type   string   `json:"rrset_type,omitempty"`
+	TTL    int32    `json:"rrset_ttl"`
+	Values []string `json:"rrset_values"`
+}
+
+// GandiProvider manages the records of a domain using the gandi livedns v5 api.
+type GandiProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.gandi.net/v5/livedns.
+	baseURL string
+	// authorization is the value of the authorization header.
+	authorization string
+	domain        string
+}
+
+// NewGandiProvider returns a provider managing the records of the given domain
+// using the gandi livedns api at baseURL. Requests are authenticated using the
+// given personal access token or, if it is empty, the deprecated api key.
+func NewGandiProvider(cli Doer, baseURL, token, apiKey, domain string) *GandiProvider {
+	authorization := "Bearer " + token
+	if token == "" {
+		authorization = "Apikey " + apiKey
+	}
+	return &GandiProvider{
+		cli:           cli,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		authorization: authorization,
+		domain:        domain,
+	}
+}
+
+// do sends an authenticated request for the record set of the given host and
+// type and decodes the reply into v. It returns false if the record set does
+// not exist, which is only the case for get requests, as the record sets are
+// created by put requests. The operation is used by the metrics.
+func (p *GandiProvider) do(ctx context.Context, operation, method, host, typ string, body, v interface{}) (bool, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return false, fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	res, err := p.request(ctx, operation, method, fmt.Sprintf("/records/%s/%s", p.name(host), typ), &buf)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		if method != http.MethodGet {
+			b, _ := readBody(res.Body)
+			return false, fmt.Errorf("%w: the gandi domain %s does not exist: %s", ErrDomainNotFound, p.domain, string(b))
+		}
+		// missing record sets and domains are both replied to with
+		// status not found, so check whether the domain exists
+		return false, p.checkDomain(ctx)
+	}
+	if err := checkResponse(res); err != nil {
+		return false, err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return false, fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return true, nil
+}
+
+// checkDomain returns an error wrapping ErrDomainNotFound if the domain
+// does not exist or is not managed by gandi livedns.
+func (p *GandiProvider) checkDomain(ctx context.Context) error {
+	res, err := p.request(ctx, "list", http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("%w: the gandi domain %s does not exist: %s", ErrDomainNotFound, p.domain, string(b))
+	}
+	return checkResponse(res)
+}
+
+// request sends an authenticated request to the given path below the domain.
+func (p *GandiProvider) request(ctx context.Context, operation, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/domains/%s%s", p.baseURL, p.domain, path), body)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", p.authorization)
+	return timedDo(p.cli, operation, req)
+}
+
+// FindRecords searches for the host records of the given type. Gandi manages
+// all values of a record as one record set, so a record is returned for every
+// value, which is also used as its id.
+func (p *GandiProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	rs, err := p.recordSet(ctx, host, typ)
+	if err != nil {
+		return nil, fmt.Errorf("error while looking up dns records using gandi api: %w", err)
+	}
+	if rs == nil {
+		return nil, nil
+	}
+	var records []*Record
+	for _, v := range rs.Values {
+		records = append(records, &Record{
+			ID:     v,
+			Host:   host,
+			Type:   typ,
+			Answer: rrsetAnswer(typ, v),
+			TTL:    rs.TTL,
+		})
+	}
+	return records, nil
+}
+
+// recordSet returns the record set of the given host and type or nil if it does not exist.
+func (p *GandiProvider) recordSet(ctx context.Context, host, typ string) (*GandiRecordSet, error) {
+	var rs GandiRecordSet
+	found, err := p.do(ctx, "list", http.MethodGet, host, typ, nil, &rs)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// CreateRecord creates the given record.
+func (p *GandiProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "create", rec, "", rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while creating dns record using gandi api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *GandiProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "update", rec, rec.ID, rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while updating dns record using gandi api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *GandiProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "delete", rec, rec.ID, ""); err != nil {
+		return fmt.Errorf("error while deleting dns record using gandi api: %s", err)
+	}
+	return nil
+}
+
+// change removes the value remove from the record set of the given record and
+// adds the value add, both are ignored if they are empty. The record set is
+// replaced by a single put, using the ttl of the record, or deleted if it ends
+// up empty. The operation is used by the metrics.
+func (p *GandiProvider) change(ctx context.Context, operation string, rec *Record, remove, add string) error {
+	current, err := p.recordSet(ctx, rec.Host, rec.Type)
+	if err != nil {
+		return err
+	}
+	rs := GandiRecordSet{TTL: rec.TTL, Values: []string{}}
+	if current != nil {
+		for _, v := range current.Values {
+			if v != remove && v != add {
+				rs.Values = append(rs.Values, v)
+			}
+		}
+	}
+	if add != "" {
+		rs.Values = append(rs.Values, add)
+	}
+	if len(rs.Values) == 0 {
+		if current == nil {
+			return nil
+		}
+		_, err := p.do(ctx, operation, http.MethodDelete, rec.Host, rec.Type, nil, nil)
+		return err
+	}
+	_, err = p.do(ctx, operation, http.MethodPut, rec.Host, rec.Type, rs, nil)
+	return err
+}
+
+// name returns the name of the given host as used by gandi.
+func (p *GandiProvider) name(host string) string {
+	if host == "" {
+		return "@"
+	}
+	return host
+}
@@ -0,0 +1,191 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gandiServer is a mock of the gandi livedns api managing the record sets of example.com.
+type gandiServer struct {
+	// missing lets the domain not exist.
+	missing bool
+	// recordSets contains the record sets by name and type, e.g. "home/A".
+	recordSets map[string]GandiRecordSet
+	// status overrides the status code of the replies by method.
+	status map[string]int
+	// requests contains the method, path and body of all requests.
+	requests []string
+}
+
+func (s *gandiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.requests = append(s.requests, strings.TrimSpace(fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, b)))
+	if status, ok := s.status[r.Method]; ok {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"failed"}`))
+		return
+	}
+	if s.missing || !strings.HasPrefix(r.URL.Path, "/domains/example.com") {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/domains/example.com"), "/records/")
+	switch r.Method {
+	case http.MethodGet:
+		if key == "" {
+			w.Write([]byte(`{"fqdn":"example.com"}`))
+			return
+		}
+		rs, ok := s.recordSets[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(rs)
+	case http.MethodPut:
+		var rs GandiRecordSet
+		json.Unmarshal(b, &rs)
+		s.recordSets[key] = rs
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(s.recordSets, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newGandiServer(t *testing.T, s *gandiServer) *GandiProvider {
+	if s.recordSets == nil {
+		s.recordSets = make(map[string]GandiRecordSet)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return NewGandiProvider(srv.Client(), srv.URL, "token", "", "example.com")
+}
+
+func TestGandiFindRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        *gandiServer
+		want     []*Record
+		requests []string
+		err      error
+	}{
+		{
+			name: "record set",
+			s:    &gandiServer{recordSets: map[string]GandiRecordSet{"home/A": {TTL: 300, Values: []string{"203.0.113.1", "203.0.113.2"}}}},
+			want: []*Record{
+				{ID: "203.0.113.1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+				{ID: "203.0.113.2", Host: "home", Type: "A", Answer: "203.0.113.2", TTL: 300},
+			},
+			requests: []string{"GET /domains/example.com/records/home/A"},
+		},
+		{
+			name:     "no record set",
+			s:        &gandiServer{},
+			requests: []string{"GET /domains/example.com/records/home/A", "GET /domains/example.com"},
+		},
+		{
+			name:     "domain not found",
+			s:        &gandiServer{missing: true},
+			requests: []string{"GET /domains/example.com/records/home/A", "GET /domains/example.com"},
+			err:      ErrDomainNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newGandiServer(t, tt.s)
+			got, err := p.FindRecords(context.Background(), "home", "A")
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestGandiChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *gandiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		requests []string
+		err      error
+	}{
+		{
+			name: "create",
+			s:    &gandiServer{},
+			op:   "create",
+			rec:  Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			requests: []string{
+				"GET /domains/example.com/records/home/A",
+				"GET /domains/example.com",
+				`PUT /domains/example.com/records/home/A {"rrset_ttl":300,"rrset_values":["203.0.113.1"]}`,
+			},
+		},
+		{
+			name: "create in missing domain",
+			s:    &gandiServer{status: map[string]int{http.MethodPut: http.StatusNotFound}},
+			op:   "create",
+			rec:  Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			requests: []string{
+				"GET /domains/example.com/records/home/A",
+				"GET /domains/example.com",
+				`PUT /domains/example.com/records/home/A {"rrset_ttl":300,"rrset_values":["203.0.113.1"]}`,
+			},
+			err: errors.New("error while creating dns record using gandi api: the domain has not been found"),
+		},
+		{
+			name: "update",
+			s:    &gandiServer{recordSets: map[string]GandiRecordSet{"home/A": {TTL: 300, Values: []string{"198.51.100.1"}}}},
+			op:   "update",
+			rec:  Record{ID: "198.51.100.1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			requests: []string{
+				"GET /domains/example.com/records/home/A",
+				`PUT /domains/example.com/records/home/A {"rrset_ttl":300,"rrset_values":["203.0.113.1"]}`,
+			},
+		},
+		{
+			name: "delete in missing domain",
+			s:    &gandiServer{recordSets: map[string]GandiRecordSet{"home/A": {TTL: 300, Values: []string{"198.51.100.1"}}}, status: map[string]int{http.MethodDelete: http.StatusNotFound}},
+			op:   "delete",
+			rec:  Record{ID: "198.51.100.1", Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+			requests: []string{
+				"GET /domains/example.com/records/home/A",
+				"DELETE /domains/example.com/records/home/A",
+			},
+			err: errors.New("error while deleting dns record using gandi api: the domain has not been found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newGandiServer(t, tt.s)
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcpScope is the oauth scope required to manage cloud dns records.
+const gcpScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+
+// gcpTokenSource returns oauth access tokens found by the google application
+// default credentials, e.g. the file at GOOGLE_APPLICATION_CREDENTIALS, the file
+// written by gcloud auth application-default login or the metadata server of the
+// compute engine instance. The tokens are cached until they expire.
+type gcpTokenSource struct {
+	cli Doer
+	mu  sync.Mutex
+	src oauth2.TokenSource
+}
+
+// token returns a valid access token, requesting a new one if necessary. The
+// oauth2 package does not cancel token requests, so they are only limited by
+// the timeout of the client and not by ctx.
+func (s *gcpTokenSource) token(_ context.Context) (string, error) {
+	src, err := s.source()
+	if err != nil {
+		return "", err
+	}
+	t, err := src.Token()
+	if err != nil {
+		var re *oauth2.RetrieveError
+		// other status codes, e.g. 5xx, are temporary errors of the token endpoint
+		if errors.As(err, &re) && re.Response != nil {
+			switch re.Response.StatusCode {
+			case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+				return "", fmt.Errorf("%w while requesting google access token: %s", ErrUnauthorized, err)
+			}
+		}
+		return "", fmt.Errorf("error while requesting google access token: %s", err)
+	}
+	return t.AccessToken, nil
+}
+
+// source looks up the application default credentials on first use. Looking
+// them up is retried with the next request if it fails.
+func (s *gcpTokenSource) source() (oauth2.TokenSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.src != nil {
+		return s.src, nil
+	}
+	// the token source keeps the context to request the tokens using the
+	// client, so it must not be the context of the cycle
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: gcpAuthTransport{cli: s.cli}})
+	src, err := google.DefaultTokenSource(ctx, gcpScope)
+	if err != nil {
+		return nil, fmt.Errorf("no google credentials found: %s", err)
+	}
+	s.src = src
+	return s.src, nil
+}
+
+// gcpAuthTransport sends the token requests of the oauth2 package using cli.
+type gcpAuthTransport struct {
+	cli Doer
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t gcpAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requesting a token twice is harmless, so it is retried like idempotent
+	// requests, the request must not be modified by a round tripper
+	return timedDo(t.cli, "auth", req.Clone(withIdempotent(req.Context())))
+}
@@ -0,0 +1,107 @@
+package namedyn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGCPCredentials writes the credentials of a service account requesting
+// its tokens at tokenURI and points GOOGLE_APPLICATION_CREDENTIALS to them.
+func newGCPCredentials(t *testing.T, tokenURI string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "namedyn@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+}
+
+func TestGCPToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// attempts is the expected number of token requests.
+		attempts     int
+		err          bool
+		unauthorized bool
+	}{
+		{name: "success", statuses: []int{200}, attempts: 1},
+		{name: "retried after 5xx", statuses: []int{503, 500, 200}, attempts: 3},
+		{name: "permanent 5xx", statuses: []int{500, 500, 500}, attempts: 3, err: true},
+		{name: "bad request", statuses: []int{400}, attempts: 1, err: true, unauthorized: true},
+		{name: "unauthorized", statuses: []int{401}, attempts: 1, err: true, unauthorized: true},
+		{name: "forbidden", statuses: []int{403}, attempts: 1, err: true, unauthorized: true},
+		{name: "not found", statuses: []int{404}, attempts: 1, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts]
+				attempts++
+				if r.Method != http.MethodPost || r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.FormValue("assertion") == "" {
+					t.Errorf("got unexpected token request %s %v", r.Method, r.Form)
+				}
+				if parts := strings.Split(r.FormValue("assertion"), "."); len(parts) == 3 {
+					claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+					if !strings.Contains(string(claims), `"scope":"`+gcpScope+`"`) {
+						t.Errorf("got claims %s, want the scope %s", claims, gcpScope)
+					}
+				}
+				if _, ok := r.Header["Idempotency-Key"]; ok {
+					t.Error("the idempotency key must not be sent")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				if status == 200 {
+					w.Write([]byte(`{"access_token":"secret","expires_in":3600}`))
+				}
+			}))
+			defer srv.Close()
+			newGCPCredentials(t, srv.URL)
+			s := &gcpTokenSource{cli: &http.Client{Transport: &RetryTransport{Base: http.DefaultTransport, MaxRetries: 2}}}
+			got, err := s.token(context.Background())
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if errors.Is(err, ErrUnauthorized) != tt.unauthorized {
+				t.Errorf("got error %v, want unauthorized %v", err, tt.unauthorized)
+			}
+			if err == nil && got != "secret" {
+				t.Errorf("got token %q, want %q", got, "secret")
+			}
+			if attempts != tt.attempts {
+				t.Errorf("got %v attempts, want %v", attempts, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package namedyn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health keeps track of the outcome of the most recent cycle.
+type Health struct {
+	// maxAge is the duration after which a successful cycle is considered stale.
+	maxAge time.Duration
+	mu     sync.Mutex
+	// last is the time the most recent cycle finished.
+	last time.Time
+	ok   bool
+}
+
+// NewHealth returns a health check considering successful cycles
+// older than maxAge as stale.
+func NewHealth(maxAge time.Duration) *Health {
+	return &Health{maxAge: maxAge}
+}
+
+// record stores the outcome of a finished cycle.
+func (h *Health) record(ok bool) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+	h.ok = ok
+}
+
+// ServeHTTP implements http.Handler, it returns 200 if the most recent cycle
+// was successful and not older than maxAge and 503 otherwise.
+func (h *Health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	last, ok := h.last, h.ok
+	h.mu.Unlock()
+	switch {
+	case last.IsZero():
+		http.Error(w, "no cycle has finished yet", http.StatusServiceUnavailable)
+	case !ok:
+		http.Error(w, fmt.Sprintf("the last cycle at %s failed", last.Format(time.RFC3339)), http.StatusServiceUnavailable)
+	case time.Since(last) > h.maxAge:
+		http.Error(w, fmt.Sprintf("the last cycle at %s is older than %s", last.Format(time.RFC3339), h.maxAge), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintf(w, "ok, the last cycle at %s was successful\n", last.Format(time.RFC3339))
+	}
+}
+
+// ServeHealth listens on the given address and serves, if they are not nil,
+// the health check at /healthz, the refresher at /refresh and the history
+// at /history in the background. Listening is done synchronously, so errors
+// are returned.
+func ServeHealth(addr string, h *Health, r *Refresher, hist *History) error {
+	return listen(addr, "health check", healthMux(h, r, hist))
+}
+
+// Serve listens on the given address and serves the metrics and, if they are
+// not nil, the health check, the refresher and the history in the background,
+// so a single port serves all endpoints. Listening is done synchronously, so
+// errors are returned.
+func Serve(addr string, h *Health, r *Refresher, hist *History) error {
+	mux := healthMux(h, r, hist)
+	mux.HandleFunc("/metrics", metricsHandler)
+	return listen(addr, "http endpoints", mux)
+}
+
+// healthMux returns a mux serving, if they are not nil, the health check
+// at /healthz, the refresher at /refresh and the history at /history.
+func healthMux(h *Health, r *Refresher, hist *History) *http.ServeMux {
+	mux := http.NewServeMux()
+	if h != nil {
+		mux.Handle("/healthz", h)
+	}
+	if r != nil {
+		mux.Handle("/refresh", r)
+	}
+	if hist != nil {
+		mux.Handle("/history", hist)
+	}
+	return mux
+}
+
+// listen listens on the given address and serves the handler in the
+// background, errors while serving are logged using the given name.
+func listen(addr, name string, handler http.Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(l, handler); err != nil {
+			logger.Error("error while serving "+name, "error", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,58 @@
+package namedyn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthServeHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		last time.Time
+		ok   bool
+		want int
+	}{
+		{name: "no cycle", want: http.StatusServiceUnavailable},
+		{name: "failed", last: time.Now(), ok: false, want: http.StatusServiceUnavailable},
+		{name: "stale", last: time.Now().Add(-time.Hour), ok: true, want: http.StatusServiceUnavailable},
+		{name: "ok", last: time.Now(), ok: true, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth(time.Minute)
+			h.last, h.ok = tt.last, tt.ok
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("got status %v, want %v: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHealthNil(t *testing.T) {
+	var h *Health
+	// must not panic, e.g. when the updater is used without a health check
+	h.record(true)
+	rec := httptest.NewRecorder()
+	healthMux(nil, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %v, want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestCycleWithoutHealth(t *testing.T) {
+	p := &fakeProvider{}
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	families := []IPFamily{{Type: "A", Fixed: "203.0.113.1"}}
+	u := NewUpdater(http.DefaultClient, entries, families)
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	if len(p.records) != 1 || p.records[0].Answer != "203.0.113.1" {
+		t.Errorf("got records %v, want a single record pointing to 203.0.113.1", p.records)
+	}
+}
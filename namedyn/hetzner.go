@@ -0,0 +1,219 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HetznerRecord represents the record type from the hetzner dns api
+// (https://dns.hetzner.com/api-docs#tag/Records).
+type HetznerRecord struct {
+	Id     string `json:"id,omitempty"`
+	ZoneId string `json:"zone_id"`
+	Type   string `json:"type"`
+	// Name is relative to the zone, the root record is named @.
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	TTL   int32  `json:"ttl"`
+}
+
+// HetznerListReply represents the reply while listing
+// records using the hetzner dns api.
+type HetznerListReply struct {
+	Records []HetznerRecord `json:"records"`
+	Meta    struct {
+		Pagination struct {
+			Page     int `json:"page"`
+			LastPage int `json:"last_page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+// errHetznerNotFound is returned by the hetzner dns api if the requested zone or record does not exist.
+var errHetznerNotFound = errors.New("not found")
+
+// HetznerProvider manages the records of a zone using the hetzner dns api.
+type HetznerProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://dns.hetzner.com/api/v1.
+	baseURL string
+	token   string
+	domain  string
+	// zoneID is looked up by the domain name.
+	zoneID string
+	mu     sync.Mutex
+}
+
+// NewHetznerProvider returns a provider managing the records of the given
+// domain using the hetzner dns api at baseURL and the given api token.
+func NewHetznerProvider(cli Doer, baseURL, token, domain string) *HetznerProvider {
+	return &HetznerProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		domain:  domain,
+	}
+}
+
+// do sends an authenticated request to the given path of the hetzner dns api
+// and decodes the reply into v. The operation is used by the metrics.
+func (p *HetznerProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, &buf)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Auth-API-Token", p.token)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("%w with status code %v: %s", errHetznerNotFound, res.StatusCode, string(b))
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// zone returns the id of the zone, looking it up if necessary,
+// as the records are managed by the id of their zone.
+func (p *HetznerProvider) zone(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.zoneID != "" {
+		return p.zoneID, nil
+	}
+	var reply struct {
+		Zones []struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}
+	if err := p.do(ctx, "list", http.MethodGet, "/zones?name="+url.QueryEscape(p.domain), nil, &reply); err != nil {
+		// the zone does not exist if the name filter does not match
+		if errors.Is(err, errHetznerNotFound) {
+			return "", fmt.Errorf("%w: could not find hetzner zone of %s", ErrDomainNotFound, p.domain)
+		}
+		return "", fmt.Errorf("error while looking up hetzner zone of %s: %w", p.domain, err)
+	}
+	for _, z := range reply.Zones {
+		if strings.EqualFold(z.Name, p.domain) {
+			p.zoneID = z.Id
+			return p.zoneID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: could not find hetzner zone of %s", ErrDomainNotFound, p.domain)
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *HetznerProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the records are paginated, so all pages
+	// need to be queried to find all records
+	var records []*Record
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("zone_id", zone)
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", "100")
+		var reply HetznerListReply
+		if err := p.do(ctx, "list", http.MethodGet, "/records?"+q.Encode(), nil, &reply); err != nil {
+			return nil, fmt.Errorf("error while listing dns records using hetzner api: %w", err)
+		}
+		for _, r := range reply.Records {
+			if strings.EqualFold(r.Name, p.name(host)) && r.Type == typ {
+				records = append(records, &Record{
+					ID:     r.Id,
+					Host:   host,
+					Type:   r.Type,
+					Answer: rrsetAnswer(r.Type, r.Value),
+					TTL:    r.TTL,
+				})
+			}
+		}
+		if reply.Meta.Pagination.Page >= reply.Meta.Pagination.LastPage {
+			return records, nil
+		}
+	}
+}
+
+// CreateRecord creates the given record.
+func (p *HetznerProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Record HetznerRecord `json:"record"`
+	}
+	if err := p.do(ctx, "create", http.MethodPost, "/records", p.hetznerRecord(zone, rec), &reply); err != nil {
+		return fmt.Errorf("error while creating dns record using hetzner api: %s", err)
+	}
+	rec.ID = reply.Record.Id
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *HetznerProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	zone, err := p.zone(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.do(ctx, "update", http.MethodPut, "/records/"+rec.ID, p.hetznerRecord(zone, rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using hetzner api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *HetznerProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.do(ctx, "delete", http.MethodDelete, "/records/"+rec.ID, nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using hetzner api: %s", err)
+	}
+	return nil
+}
+
+// name returns the name of the given host as used by hetzner.
+func (p *HetznerProvider) name(host string) string {
+	if host == "" {
+		return "@"
+	}
+	return host
+}
+
+// hetznerRecord converts the given record to a hetzner record of the given zone.
+func (p *HetznerProvider) hetznerRecord(zone string, rec *Record) *HetznerRecord {
+	return &HetznerRecord{
+		ZoneId: zone,
+		Type:   rec.Type,
+		Name:   p.name(rec.Host),
+		Value:  rrsetValue(rec.Type, rec.Answer),
+		TTL:    rec.TTL,
+	}
+}
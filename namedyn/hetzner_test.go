@@ -0,0 +1,252 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hetznerAPI returns a mock of the hetzner dns api managing the records of the zone z1 of example.com on the given pages.
+func hetznerAPI(pages ...[]HetznerRecord) *apiServer {
+	return &apiServer{
+		auth:   headerAuth("Auth-API-Token", "token", `{"message":"Invalid authentication credentials"}`),
+		failed: `{"error":{"message":"failed"}}`,
+		handle: func(w http.ResponseWriter, r *http.Request, b []byte) {
+			switch {
+			case r.URL.Path == "/zones":
+				// the api replies 404 if no zone matches the name
+				if r.URL.Query().Get("name") != "example.com" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"zones":[],"error":{"message":"zone not found","code":404}}`))
+					return
+				}
+				w.Write([]byte(`{"zones":[{"id":"z1","name":"example.com"}]}`))
+			case r.Method == http.MethodGet && r.URL.Path == "/records":
+				if r.URL.Query().Get("zone_id") != "z1" {
+					http.NotFound(w, r)
+					return
+				}
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				var reply HetznerListReply
+				if page >= 1 && page <= len(pages) {
+					reply.Records = pages[page-1]
+				}
+				reply.Meta.Pagination.Page = page
+				reply.Meta.Pagination.LastPage = len(pages)
+				json.NewEncoder(w).Encode(reply)
+			case r.Method == http.MethodPost && r.URL.Path == "/records":
+				var rec HetznerRecord
+				json.Unmarshal(b, &rec)
+				rec.Id = "r3"
+				json.NewEncoder(w).Encode(map[string]interface{}{"record": rec})
+			case r.Method == http.MethodPut:
+				w.Write([]byte(`{"record":` + string(b) + `}`))
+			case r.Method == http.MethodDelete:
+				w.WriteHeader(http.StatusOK)
+			}
+		},
+	}
+}
+
+func TestHetznerFindRecords(t *testing.T) {
+	zones := "GET /zones?name=example.com"
+	list := "GET /records?page=%v&per_page=100&zone_id=z1"
+	tests := []struct {
+		name     string
+		s        *apiServer
+		token    string
+		host     string
+		typ      string
+		want     []*Record
+		requests []string
+		err      error
+	}{
+		{
+			name: "record",
+			s: hetznerAPI([]HetznerRecord{
+				{Id: "r1", ZoneId: "z1", Type: "A", Name: "home", Value: "203.0.113.1", TTL: 300},
+				{Id: "r2", ZoneId: "z1", Type: "AAAA", Name: "home", Value: "2001:db8::1", TTL: 300},
+			}),
+			host:     "home",
+			typ:      "A",
+			want:     []*Record{{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{zones, fmt.Sprintf(list, 1)},
+		},
+		{
+			name: "record on second page",
+			s: hetznerAPI(
+				[]HetznerRecord{{Id: "r1", ZoneId: "z1", Type: "A", Name: "nas", Value: "203.0.113.2", TTL: 300}},
+				[]HetznerRecord{{Id: "r2", ZoneId: "z1", Type: "A", Name: "HOME", Value: "203.0.113.1", TTL: 600}},
+			),
+			host:     "home",
+			typ:      "A",
+			want:     []*Record{{ID: "r2", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600}},
+			requests: []string{zones, fmt.Sprintf(list, 1), fmt.Sprintf(list, 2)},
+		},
+		{
+			name:     "root cname record",
+			s:        hetznerAPI([]HetznerRecord{{Id: "r1", ZoneId: "z1", Type: "CNAME", Name: "@", Value: "target.example.net.", TTL: 300}}),
+			typ:      "CNAME",
+			want:     []*Record{{ID: "r1", Host: "", Type: "CNAME", Answer: "target.example.net", TTL: 300}},
+			requests: []string{zones, fmt.Sprintf(list, 1)},
+		},
+		{
+			name:     "not found",
+			s:        hetznerAPI(nil),
+			host:     "home",
+			typ:      "A",
+			requests: []string{zones, fmt.Sprintf(list, 1)},
+		},
+		{
+			name:     "zone not found",
+			s:        hetznerAPI().fail(http.MethodGet, http.StatusNotFound),
+			host:     "home",
+			typ:      "A",
+			requests: []string{zones},
+			err:      ErrDomainNotFound,
+		},
+		{
+			name:     "unauthorized",
+			s:        hetznerAPI(),
+			token:    "wrong",
+			host:     "home",
+			typ:      "A",
+			requests: []string{zones},
+			err:      ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = "token"
+			}
+			srv := tt.s.start(t)
+			p := NewHetznerProvider(srv.Client(), srv.URL+"/", token, "example.com")
+			got, err := p.FindRecords(context.Background(), tt.host, tt.typ)
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestHetznerChanges(t *testing.T) {
+	zones := "GET /zones?name=example.com"
+	tests := []struct {
+		name string
+		s    *apiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		id       string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			s:        hetznerAPI(),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r3",
+			requests: []string{zones, `POST /records {"zone_id":"z1","type":"A","name":"home","value":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "create txt record",
+			s:        hetznerAPI(),
+			op:       "create",
+			rec:      Record{Host: "_acme", Type: "TXT", Answer: "a b", TTL: 300},
+			id:       "r3",
+			requests: []string{zones, `POST /records {"zone_id":"z1","type":"TXT","name":"_acme","value":"\"a b\"","ttl":300}`},
+		},
+		{
+			name:     "update root record",
+			s:        hetznerAPI(),
+			op:       "update",
+			rec:      Record{ID: "r1", Host: "", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{zones, `PUT /records/r1 {"zone_id":"z1","type":"A","name":"@","value":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "delete",
+			s:        hetznerAPI(),
+			op:       "delete",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{"DELETE /records/r1"},
+		},
+		{
+			name:     "create in missing zone",
+			s:        hetznerAPI().fail(http.MethodGet, http.StatusNotFound),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			requests: []string{zones},
+			err:      ErrDomainNotFound,
+		},
+		{
+			name:     "update rejected",
+			s:        hetznerAPI().fail(http.MethodPut, http.StatusUnprocessableEntity),
+			op:       "update",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{zones, `PUT /records/r1 {"zone_id":"z1","type":"A","name":"home","value":"203.0.113.1","ttl":300}`},
+			err:      errors.New("error while updating dns record using hetzner api: unexpected status code 422"),
+		},
+		{
+			name:     "delete missing record",
+			s:        hetznerAPI().fail(http.MethodDelete, http.StatusNotFound),
+			op:       "delete",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{"DELETE /records/r1"},
+			err:      errors.New("error while deleting dns record using hetzner api: not found with status code 404"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.s.start(t)
+			p := NewHetznerProvider(srv.Client(), srv.URL+"/", "token", "example.com")
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestHetznerLooksUpZoneOnce(t *testing.T) {
+	s := hetznerAPI(nil)
+	srv := s.start(t)
+	p := NewHetznerProvider(srv.Client(), srv.URL+"/", "token", "example.com")
+	for i := 0; i < 2; i++ {
+		if _, err := p.FindRecords(context.Background(), "home", "A"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := strings.Count(strings.Join(s.requests, "\n"), "GET /zones"); n != 1 {
+		t.Errorf("got %v zone lookups, want 1: %q", n, s.requests)
+	}
+}
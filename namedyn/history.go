@@ -0,0 +1,69 @@
+package namedyn
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// History keeps the most recent changes of the records in memory.
+type History struct {
+	// size is the maximum number of changes kept.
+	size    int
+	mu      sync.Mutex
+	changes []Change
+}
+
+// NewHistory returns a history keeping the given number of changes.
+func NewHistory(size int) *History {
+	return &History{size: size}
+}
+
+// add appends the given change, dropping the oldest one if the history is full.
+func (h *History) add(c Change) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.changes = append(h.changes, c)
+	if len(h.changes) > h.size {
+		h.changes = h.changes[len(h.changes)-h.size:]
+	}
+}
+
+// list returns a copy of the changes, the oldest one first.
+func (h *History) list() []Change {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Change(nil), h.changes...)
+}
+
+// restore replaces the changes, e.g. by the ones loaded from the state file.
+func (h *History) restore(changes []Change) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.changes = append([]Change(nil), changes...)
+	if len(h.changes) > h.size {
+		h.changes = h.changes[len(h.changes)-h.size:]
+	}
+}
+
+// ServeHTTP implements http.Handler, it returns the changes
+// as a json array, the oldest one first.
+func (h *History) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	changes := h.list()
+	if changes == nil {
+		changes = []Change{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		logger.Error("error while writing history", "error", err)
+	}
+}
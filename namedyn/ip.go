@@ -0,0 +1,360 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPFamily describes a record type together with the
+// sources used to lookup the matching own public ip.
+type IPFamily struct {
+	// Type is the record type, either A or AAAA.
+	Type string
+	// Sources contains the urls of ip echo services, dns sources
+	// prefixed with dns: or doh: or upnp, which are tried in order.
+	Sources []string
+	// Interface is the name of the network interface to read the ip from
+	// instead of the sources, if it is not empty.
+	Interface string
+	// Fallback enables the sources in case reading the ip of Interface fails.
+	Fallback bool
+	// All looks up every ip returned by the sources or the interface
+	// instead of only the first one, e.g. when using multiple isps.
+	All bool
+	// Static contains ips which are always used in addition to the looked up ones.
+	Static []string
+	// JSONPaths contains the paths of the ip within the json replies of
+	// sources by their url, e.g. .wan.ip for the local api of a router.
+	// The replies of the other sources contain only the ip.
+	JSONPaths map[string]string
+	// FallbackIP is used if looking up the ip fails, e.g. while the interface
+	// is down, so the records point to a status page, if it is not empty.
+	FallbackIP string
+	// Fixed is used instead of looking up the ip, if it is not empty.
+	Fixed string
+	// Optional families are skipped if the lookup fails, as all
+	// of their records are optional.
+	Optional bool
+	// AllowPrivate accepts looked up ips which are not public, e.g. private,
+	// loopback, link-local or carrier-grade nat addresses. They are skipped
+	// otherwise, as publishing them is worse than keeping the records.
+	AllowPrivate bool
+}
+
+// lookupIPs queries the sources of the family in order and returns the first
+// valid ip or all distinct valid ips if All is set, together with the static
+// ips. The fallback ip is returned instead if the lookup fails.
+func (f IPFamily) lookupIPs(ctx context.Context, cli Doer) ([]string, error) {
+	ips, err := f.lookup(ctx, cli)
+	if err != nil && f.FallbackIP != "" {
+		ctxLogger(ctx).Warn("no own ip found, applying the fallback ip", "type", f.Type, "ip", f.FallbackIP, "error", err)
+		ips, err = []string{f.FallbackIP}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range f.Static {
+		ips = appendUnique(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// lookup returns the looked up ips without the static ones.
+func (f IPFamily) lookup(ctx context.Context, cli Doer) ([]string, error) {
+	if f.Fixed != "" {
+		return []string{f.Fixed}, nil
+	}
+	if f.Interface != "" {
+		ips, err := interfaceIPs(f.Interface, f.Type, f.AllowPrivate)
+		if err == nil || !f.Fallback {
+			if err == nil && !f.All {
+				ips = ips[:1]
+			}
+			return ips, err
+		}
+		ctxLogger(ctx).Warn("falling back to ip sources", "type", f.Type, "interface", f.Interface, "error", err)
+	}
+	var ips, errs []string
+	for _, src := range f.Sources {
+		var ip string
+		var err error
+		if name := strings.TrimPrefix(src, "dns:"); name != src {
+			ip, err = lookupDNSIP(ctx, name, f.Type)
+		} else if name := strings.TrimPrefix(src, "doh:"); name != src {
+			ip, err = lookupDoHIP(ctx, cli, name, f.Type)
+		} else if src == "upnp" {
+			ip, err = lookupUPnPIP(ctx, cli)
+		} else if path, ok := f.JSONPaths[src]; ok {
+			ip, err = lookupJSONIP(ctx, cli, src, path)
+		} else {
+			ip, err = lookupIP(ctx, cli, src)
+		}
+		if err == nil {
+			ip, err = validateIP(ip, f.Type)
+		}
+		if err == nil && !f.AllowPrivate && !isPublicIP(net.ParseIP(ip)) {
+			ctxLogger(ctx).Warn("own ip is not public, skipping it unless ALLOW_PRIVATE_IP is set", "type", f.Type, "source", src, "ip", ip)
+			err = fmt.Errorf("%s returned %s, which is not a public address", src, ip)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !f.All {
+			return []string{ip}, nil
+		}
+		ips = appendUnique(ips, ip)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("all ip sources failed: %s", strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		ctxLogger(ctx).Warn("some ip sources failed", "type", f.Type, "error", strings.Join(errs, "; "))
+	}
+	return ips, nil
+}
+
+// appendUnique appends s to list if it is not contained yet.
+func appendUnique(list []string, s string) []string {
+	if containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+// lookupIP queries the given ip echo service to lookup the own public ip.
+func lookupIP(ctx context.Context, cli Doer, ipURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ipURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error while creating request to %s: %s", ipURL, err)
+	}
+	res, err := timedDo(cli, "ip", req)
+	if err != nil {
+		return "", fmt.Errorf("error while querying %s to lookup own ip: %s", ipURL, err)
+	}
+	defer res.Body.Close()
+	b, err := readBody(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("error while reading response body from %s: %s", ipURL, err)
+	}
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("unexpected status code %v while looking up own ip using %s: %s", res.StatusCode, ipURL, string(b))
+	}
+	return string(b), nil
+}
+
+// lookupJSONIP queries the given url and returns the value at the given
+// path of the json reply, e.g. of the local api of a router.
+func lookupJSONIP(ctx context.Context, cli Doer, ipURL, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ipURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error while creating request to %s: %s", ipURL, err)
+	}
+	res, err := timedDo(cli, "ip", req)
+	if err != nil {
+		return "", fmt.Errorf("error while querying %s to lookup own ip: %s", ipURL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		b, _ := readBody(res.Body)
+		return "", fmt.Errorf("unexpected status code %v while looking up own ip using %s: %s", res.StatusCode, ipURL, string(b))
+	}
+	var v interface{}
+	// the replies of apis are usually larger than the ones of echo services
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&v); err != nil {
+		return "", fmt.Errorf("could not decode the reply of %s: %s", ipURL, err)
+	}
+	ip, err := jsonPath(v, path)
+	if err != nil {
+		return "", fmt.Errorf("could not find %s in the reply of %s: %s", path, ipURL, err)
+	}
+	return ip, nil
+}
+
+// jsonPath returns the string at the given path of the decoded json value v.
+// The path consists of the names of the fields separated by dots and array
+// indexes, e.g. .wan.ip or .interfaces[0].address.
+func jsonPath(v interface{}, path string) (string, error) {
+	for _, name := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		var indexes []string
+		if i := strings.Index(name, "["); i >= 0 {
+			if !strings.HasSuffix(name, "]") {
+				return "", fmt.Errorf("invalid path element %s", name)
+			}
+			indexes = strings.Split(name[i+1:len(name)-1], "][")
+			name = name[:i]
+		}
+		if name != "" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s is not a field of an object", name)
+			}
+			if v, ok = m[name]; !ok {
+				return "", fmt.Errorf("the field %s does not exist", name)
+			}
+		}
+		for _, index := range indexes {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return "", fmt.Errorf("invalid index %s", index)
+			}
+			a, ok := v.([]interface{})
+			if !ok || i < 0 || i >= len(a) {
+				return "", fmt.Errorf("index %v of %s does not exist", i, name)
+			}
+			v = a[i]
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("the value is not a string")
+	}
+	return s, nil
+}
+
+// dnsSource describes a dns query returning the public ip of the client.
+type dnsSource struct {
+	// servers contains the address of the name server to query by record type,
+	// the queries need to reach them using the address family of the record type.
+	servers map[string]string
+	name    string
+	// txt is true if the ip is returned as txt record instead of an address record.
+	txt bool
+}
+
+// dnsSources contains the supported dns sources by name.
+var dnsSources = map[string]dnsSource{
+	"opendns": {
+		servers: map[string]string{"A": "208.67.222.222:53", "AAAA": "[2620:119:35::35]:53"},
+		name:    "myip.opendns.com",
+	},
+	"google": {
+		servers: map[string]string{"A": "216.239.32.10:53", "AAAA": "[2001:4860:4802:32::a]:53"},
+		name:    "o-o.myaddr.l.google.com",
+		txt:     true,
+	},
+}
+
+// lookupDNSIP queries the dns source with the given name to lookup
+// the own public ip, which is useful if http requests to ip echo
+// services are blocked.
+func lookupDNSIP(ctx context.Context, name, typ string) (string, error) {
+	src, ok := dnsSources[name]
+	if !ok {
+		return "", fmt.Errorf("unknown dns source %s", name)
+	}
+	server := src.servers[typ]
+	start := time.Now()
+	defer func() { requestDuration.observe(time.Since(start).Seconds(), "ip") }()
+	r := serverResolver(server)
+	if src.txt {
+		txts, err := r.LookupTXT(ctx, src.name)
+		if err != nil {
+			return "", fmt.Errorf("error while querying %s to lookup own ip: %s", server, err)
+		}
+		for _, t := range txts {
+			if ip, err := validateIP(t, typ); err == nil {
+				return ip, nil
+			}
+		}
+		return "", fmt.Errorf("%s did not return a valid ip for %s", server, src.name)
+	}
+	network := "ip4"
+	if typ == "AAAA" {
+		network = "ip6"
+	}
+	ips, err := r.LookupIP(ctx, network, src.name)
+	if err != nil {
+		return "", fmt.Errorf("error while querying %s to lookup own ip: %s", server, err)
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("%s did not return an ip for %s", server, src.name)
+	}
+	return ips[0].String(), nil
+}
+
+// serverResolver returns a resolver sending all queries to the name
+// server at the given address instead of the ones configured by the system.
+func serverResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// validateIP trims the given ip and makes sure it is a valid
+// address for the given record type.
+func validateIP(s, typ string) (string, error) {
+	s = strings.TrimSpace(s)
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("invalid ip %q", s)
+	}
+	switch {
+	case typ == "A" && ip.To4() == nil:
+		return "", fmt.Errorf("%s is not a valid IPv4 address", s)
+	case typ == "AAAA" && ip.To4() != nil:
+		return "", fmt.Errorf("%s is not a valid IPv6 address", s)
+	}
+	return ip.String(), nil
+}
+
+// interfaceIPs returns the global unicast addresses of the given network
+// interface which are valid for the given record type. Addresses which are
+// not public are skipped, unless allowPrivate is set.
+func interfaceIPs(name, typ string, allowPrivate bool) ([]string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("error while looking up network interface %s: %s", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading addresses of network interface %s: %s", name, err)
+	}
+	var ips []string
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || !n.IP.IsGlobalUnicast() || (!allowPrivate && !isPublicIP(n.IP)) {
+			continue
+		}
+		if ip, err := validateIP(n.IP.String(), typ); err == nil {
+			ips = appendUnique(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("network interface %s has no public %s address", name, typ)
+	}
+	return ips, nil
+}
+
+// cgnat is the shared address space used by carrier-grade nat (rfc 6598).
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP returns false for private, loopback, link-local, unspecified
+// and carrier-grade nat addresses, which are not reachable from the internet.
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !cgnat.Contains(ip)
+}
+
+// ParseIP validates the given ip and returns it together with
+// the matching record type, either A or AAAA.
+func ParseIP(s string) (string, string, error) {
+	if ip, err := validateIP(s, "A"); err == nil {
+		return ip, "A", nil
+	}
+	ip, err := validateIP(s, "AAAA")
+	return ip, "AAAA", err
+}
@@ -0,0 +1,126 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateIP(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		typ  string
+		want string
+		err  bool
+	}{
+		{name: "ipv4", s: "203.0.113.1", typ: "A", want: "203.0.113.1"},
+		{name: "trailing whitespace", s: "203.0.113.1\r\n", typ: "A", want: "203.0.113.1"},
+		{name: "leading whitespace", s: " \t203.0.113.1", typ: "A", want: "203.0.113.1"},
+		{name: "html error page", s: "<html><body>502 Bad Gateway</body></html>", typ: "A", err: true},
+		{name: "empty", s: "", typ: "A", err: true},
+		{name: "ipv6 for A", s: "2001:db8::1", typ: "A", err: true},
+		{name: "ipv6", s: "2001:DB8:0::1\n", typ: "AAAA", want: "2001:db8::1"},
+		{name: "ipv4 for AAAA", s: "203.0.113.1", typ: "AAAA", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateIP(tt.s, tt.typ)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := `{
+		"ip": "203.0.113.1",
+		"wan": {"ipv4": {"address": "203.0.113.2"}, "up": true, "mtu": 1500, "gateway": null},
+		"interfaces": [{"address": "203.0.113.3"}, {"address": "203.0.113.4", "aliases": ["203.0.113.5", "203.0.113.6"]}],
+		"matrix": [["203.0.113.7"], ["203.0.113.8", "203.0.113.9"]]
+	}`
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+		err  string
+	}{
+		{path: ".ip", want: "203.0.113.1"},
+		{path: "ip", want: "203.0.113.1"},
+		{path: ".wan.ipv4.address", want: "203.0.113.2"},
+		{path: ".interfaces[0].address", want: "203.0.113.3"},
+		{path: ".interfaces[1].aliases[1]", want: "203.0.113.6"},
+		{path: ".matrix[1][0]", want: "203.0.113.8"},
+		{path: ".missing", err: "the field missing does not exist"},
+		{path: ".wan.ipv6.address", err: "the field ipv6 does not exist"},
+		{path: ".ip.address", err: "address is not a field of an object"},
+		{path: ".interfaces.address", err: "address is not a field of an object"},
+		{path: ".interfaces[2].address", err: "index 2 of interfaces does not exist"},
+		{path: ".interfaces[-1].address", err: "index -1 of interfaces does not exist"},
+		{path: ".wan[0]", err: "index 0 of wan does not exist"},
+		{path: ".interfaces[x]", err: "invalid index x"},
+		{path: ".interfaces[0", err: "invalid path element interfaces[0"},
+		{path: ".wan", err: "the value is not a string"},
+		{path: ".wan.up", err: "the value is not a string"},
+		{path: ".wan.mtu", err: "the value is not a string"},
+		{path: ".wan.gateway", err: "the value is not a string"},
+		{path: ".interfaces", err: "the value is not a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := jsonPath(v, tt.path)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupIPs(t *testing.T) {
+	tests := []struct {
+		name string
+		// body is the reply of the ip echo service.
+		body string
+		want string
+		err  bool
+	}{
+		{name: "valid ip", body: "203.0.113.1", want: "203.0.113.1"},
+		{name: "trailing newline", body: "203.0.113.1\n", want: "203.0.113.1"},
+		{name: "html error page", body: "<!DOCTYPE html><html><body>rate limited</body></html>", err: true},
+		{name: "private ip", body: "192.168.1.10", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			f := IPFamily{Type: "A", Sources: []string{srv.URL}}
+			got, err := f.lookupIPs(context.Background(), srv.Client())
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err == nil && (len(got) != 1 || got[0] != tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LinodeRecord represents the domain record type from the linode api
+// (https://techdocs.akamai.com/linode-api/reference/get-domain-records).
+type LinodeRecord struct {
+	Id   int64  `json:"id,omitempty"`
+	Type string `json:"type"`
+	// Name is relative to the domain, it is empty for the root record.
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int32  `json:"ttl_sec"`
+}
+
+// LinodeListReply represents a page of the reply while
+// listing domains or records using the linode api.
+type LinodeListReply struct {
+	Data  json.RawMessage `json:"data"`
+	Page  int             `json:"page"`
+	Pages int             `json:"pages"`
+}
+
+// LinodeProvider manages the records of a domain using the linode v4 api.
+type LinodeProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.linode.com/v4.
+	baseURL string
+	token   string
+	domain  string
+	// domainID is looked up by the domain name.
+	domainID int64
+	mu       sync.Mutex
+}
+
+// NewLinodeProvider returns a provider managing the records of the given
+// domain using the linode api at baseURL and the given personal access token.
+func NewLinodeProvider(cli Doer, baseURL, token, domain string) *LinodeProvider {
+	return &LinodeProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		domain:  domain,
+	}
+}
+
+// do sends an authenticated request to the given path of the linode api
+// and decodes the reply into v. The operation is used by the metrics.
+func (p *LinodeProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, &buf)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// list queries all pages of the given path and calls f with the data of every page.
+func (p *LinodeProvider) list(ctx context.Context, path string, f func(data json.RawMessage) error) error {
+	for page := 1; ; page++ {
+		var reply LinodeListReply
+		if err := p.do(ctx, "list", http.MethodGet, fmt.Sprintf("%s?page=%v&page_size=500", path, page), nil, &reply); err != nil {
+			return err
+		}
+		if err := f(reply.Data); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+		if reply.Page >= reply.Pages {
+			return nil
+		}
+	}
+}
+
+// domainRecords returns the path of the records of the domain, looking up its id if necessary.
+func (p *LinodeProvider) domainRecords(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.domainID == 0 {
+		err := p.list(ctx, "/domains", func(data json.RawMessage) error {
+			var domains []struct {
+				Id     int64  `json:"id"`
+				Domain string `json:"domain"`
+			}
+			if err := json.Unmarshal(data, &domains); err != nil {
+				return err
+			}
+			for _, d := range domains {
+				if strings.EqualFold(d.Domain, p.domain) {
+					p.domainID = d.Id
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error while looking up linode domain %s: %w", p.domain, err)
+		}
+		if p.domainID == 0 {
+			return "", fmt.Errorf("%w: could not find linode domain %s", ErrDomainNotFound, p.domain)
+		}
+	}
+	return fmt.Sprintf("/domains/%v/records", p.domainID), nil
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *LinodeProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	path, err := p.domainRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	err = p.list(ctx, path, func(data json.RawMessage) error {
+		var page []LinodeRecord
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		for _, r := range page {
+			if strings.EqualFold(r.Name, host) && r.Type == typ {
+				records = append(records, r.record(host))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while listing dns records using linode api: %w", err)
+	}
+	return records, nil
+}
+
+// CreateRecord creates the given record.
+func (p *LinodeProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	path, err := p.domainRecords(ctx)
+	if err != nil {
+		return err
+	}
+	var reply LinodeRecord
+	if err := p.do(ctx, "create", http.MethodPost, path, linodeRecord(rec), &reply); err != nil {
+		return fmt.Errorf("error while creating dns record using linode api: %s", err)
+	}
+	rec.ID = strconv.FormatInt(reply.Id, 10)
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *LinodeProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	path, err := p.domainRecords(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.do(ctx, "update", http.MethodPut, path+"/"+rec.ID, linodeRecord(rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using linode api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *LinodeProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	path, err := p.domainRecords(ctx)
+	if err != nil {
+		return err
+	}
+	if err := p.do(ctx, "delete", http.MethodDelete, path+"/"+rec.ID, nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using linode api: %s", err)
+	}
+	return nil
+}
+
+// linodeTTLs are the ttls allowed by linode in ascending order,
+// others are rounded up to the next allowed one by the api.
+var linodeTTLs = []int32{30, 120, 300, 3600, 7200, 14400, 28800, 57600, 86400, 172800, 345600, 604800, 1209600, 2419200}
+
+// linodeTTL returns the given ttl rounded up to the next ttl allowed by linode.
+func linodeTTL(ttl int32) int32 {
+	for _, t := range linodeTTLs {
+		if ttl <= t {
+			return t
+		}
+	}
+	return linodeTTLs[len(linodeTTLs)-1]
+}
+
+// applied returns the ttl rounded up like linode does, so records
+// with another ttl are not updated again on every resync.
+func (p *LinodeProvider) applied(_ string, ttl int32, options map[string]string) (int32, map[string]string) {
+	return linodeTTL(ttl), options
+}
+
+// linodeRecord converts the given record to a linode record.
+func linodeRecord(rec *Record) *LinodeRecord {
+	return &LinodeRecord{
+		Type:   rec.Type,
+		Name:   rec.Host,
+		Target: rec.Answer,
+		TTL:    linodeTTL(rec.TTL),
+	}
+}
+
+// record converts the linode record to a provider independent record.
+func (r *LinodeRecord) record(host string) *Record {
+	return &Record{
+		ID:     strconv.FormatInt(r.Id, 10),
+		Host:   host,
+		Type:   r.Type,
+		Answer: r.Target,
+		TTL:    r.TTL,
+	}
+}
@@ -0,0 +1,92 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinodeTTL(t *testing.T) {
+	tests := []struct {
+		ttl  int32
+		want int32
+	}{
+		{ttl: 30, want: 30},
+		{ttl: 60, want: 120},
+		{ttl: 300, want: 300},
+		{ttl: 600, want: 3600},
+		{ttl: 3600, want: 3600},
+		{ttl: 5000000, want: 2419200},
+	}
+	for _, tt := range tests {
+		if got := linodeTTL(tt.ttl); got != tt.want {
+			t.Errorf("got ttl %v for %v, want %v", got, tt.ttl, tt.want)
+		}
+	}
+}
+
+// linodeServer is a mock of the linode api managing the given records of example.com.
+type linodeServer struct {
+	records []LinodeRecord
+	// requests contains the method, path and body of the changes.
+	requests []string
+}
+
+func (s *linodeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var data interface{} = s.records
+	switch {
+	case r.URL.Path == "/domains":
+		data = []map[string]interface{}{{"id": 1, "domain": "example.com"}}
+	case r.Method != http.MethodGet:
+		b, _ := ioutil.ReadAll(r.Body)
+		s.requests = append(s.requests, strings.TrimSpace(fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, b)))
+		w.Write([]byte(`{"id":2}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "page": 1, "pages": 1})
+}
+
+func TestCycleLinodeTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []LinodeRecord
+		requests []string
+	}{
+		{
+			name:    "rounded ttl",
+			records: []LinodeRecord{{Id: 1, Type: "A", Name: "home", Target: "203.0.113.1", TTL: 3600}},
+		},
+		{
+			name:     "other ttl",
+			records:  []LinodeRecord{{Id: 1, Type: "A", Name: "home", Target: "203.0.113.1", TTL: 300}},
+			requests: []string{`PUT /domains/1/records/1 {"type":"A","name":"home","target":"203.0.113.1","ttl_sec":3600}`},
+		},
+		{
+			name:     "create",
+			requests: []string{`POST /domains/1/records {"type":"A","name":"home","target":"203.0.113.1","ttl_sec":3600}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &linodeServer{records: tt.records}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			p := NewLinodeProvider(srv.Client(), srv.URL, "token", "example.com")
+			// linode rounds the ttl up to 3600
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 600, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
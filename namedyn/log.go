@@ -0,0 +1,125 @@
+package namedyn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// logger is used for all log output of the dns handling.
+var logger = slog.New(newTextHandler(log.Writer()))
+
+// SetLogger replaces the logger used for all log output, which defaults
+// to a text logger writing messages of at least level info to the
+// output of the standard logger.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// loggerKey is the context key of the logger of a cycle.
+type loggerKey struct{}
+
+// withCycleID returns a context carrying a logger which adds a new random
+// cycle id to all messages, so the messages of a cycle can be told apart.
+func withCycleID(ctx context.Context) context.Context {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return context.WithValue(ctx, loggerKey{}, logger.With("cycle_id", hex.EncodeToString(b)))
+}
+
+// ctxLogger returns the logger of the cycle of the given context
+// or the logger of the package outside of cycles.
+func ctxLogger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return logger
+}
+
+// NewLogger returns a logger writing messages of at least the given level
+// to w using the given format, which is either text or json.
+func NewLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		h := newTextHandler(w)
+		h.level = level
+		return slog.New(h), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 {
+					switch a.Key {
+					case slog.TimeKey:
+						a.Key = "ts"
+					case slog.LevelKey:
+						a.Key = "level"
+						a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+					}
+				}
+				return a
+			},
+		})), nil
+	}
+	return nil, fmt.Errorf("unknown log format %s", format)
+}
+
+// textHandler is a slog handler which keeps the classic log format,
+// e.g. "2020/07/14 12:00:00 INFO: created record host=home.example.com".
+type textHandler struct {
+	l     *log.Logger
+	level slog.Level
+	attrs string
+}
+
+// newTextHandler returns a text handler writing to w.
+func newTextHandler(w io.Writer) *textHandler {
+	return &textHandler{l: log.New(w, "", log.LstdFlags), level: slog.LevelInfo}
+}
+
+// Enabled implements slog.Handler.
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level
+}
+
+// Handle implements slog.Handler.
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s%s", r.Level, r.Message, h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteString(formatAttr(a))
+		return true
+	})
+	return h.l.Output(2, b.String())
+}
+
+// WithAttrs implements slog.Handler.
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		b.WriteString(formatAttr(a))
+	}
+	return &textHandler{l: h.l, level: h.level, attrs: b.String()}
+}
+
+// WithGroup implements slog.Handler, groups are not supported
+// by the text format and therefore ignored.
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// formatAttr formats the given attribute as " key=value",
+// quoting the value if it contains spaces.
+func formatAttr(a slog.Attr) string {
+	v := a.Value.Resolve().String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf(" %s=%s", a.Key, v)
+}
@@ -0,0 +1,123 @@
+package namedyn
+
+import (
+	"context"
+	"strings"
+)
+
+// markerValue is the answer of the txt records marking the records of a
+// host and type as managed by namedyn, it is followed by the type.
+const markerValue = "managed-by=namedyn type="
+
+// markerHost returns the host of the txt records marking the records of the
+// given host as managed by namedyn. The records need a companion record,
+// as most providers do not support comments on records. Wildcards can not
+// be part of the name, so they are replaced by a label.
+func markerHost(host string) string {
+	switch {
+	case host == "":
+		return "_namedyn"
+	case host == "*":
+		return "_namedyn-wildcard"
+	case strings.HasPrefix(host, "*."):
+		return "_namedyn-wildcard." + strings.TrimPrefix(host, "*.")
+	}
+	return "_namedyn." + host
+}
+
+// markers returns the txt records marking the records of the given entry
+// as managed by namedyn.
+func (u *Updater) markers(ctx context.Context, e Entry) ([]*Record, error) {
+	listCtx, cancel := withTimeout(ctx, u.ListTimeout)
+	defer cancel()
+	records, err := e.Provider.FindRecords(listCtx, markerHost(e.Host), "TXT")
+	if err != nil {
+		return nil, err
+	}
+	var markers []*Record
+	for _, r := range records {
+		if r.Answer == markerValue+e.Type {
+			markers = append(markers, r)
+		}
+	}
+	return markers, nil
+}
+
+// managed returns true if the records of the given entry are marked
+// as managed by namedyn.
+func (u *Updater) managed(ctx context.Context, e Entry) (bool, error) {
+	markers, err := u.markers(ctx, e)
+	return len(markers) > 0, err
+}
+
+// mark creates the txt record marking the records of the given
+// entry as managed by namedyn.
+func (u *Updater) mark(ctx context.Context, e Entry) error {
+	updateCtx, cancel := withTimeout(ctx, u.UpdateTimeout)
+	defer cancel()
+	return e.Provider.CreateRecord(updateCtx, &Record{
+		Host:   markerHost(e.Host),
+		Type:   "TXT",
+		Answer: markerValue + e.Type,
+		TTL:    e.TTL,
+	})
+}
+
+// unmark deletes the txt records marking the records of the given entry as
+// managed by namedyn once the last of them has been deleted, so records
+// created later by others are not considered managed.
+func (u *Updater) unmark(ctx context.Context, e Entry) error {
+	markers, err := u.markers(ctx, e)
+	if err != nil {
+		return err
+	}
+	for _, r := range markers {
+		updateCtx, cancel := withTimeout(ctx, u.UpdateTimeout)
+		err := e.Provider.DeleteRecord(updateCtx, r)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogManaged logs whether the existing records of the entries are marked as
+// managed by namedyn, so it is obvious which records StrictOwnership protects.
+// It does nothing unless the records are marked.
+func (u *Updater) LogManaged(ctx context.Context) {
+	if !u.MarkRecords && !u.StrictOwnership {
+		return
+	}
+	for _, e := range u.entries {
+		hostname := e.Hostname()
+		listCtx, cancel := withTimeout(ctx, u.ListTimeout)
+		records, err := e.Provider.FindRecords(listCtx, e.Host, e.Type)
+		cancel()
+		var managed bool
+		if err == nil {
+			managed, err = u.managed(ctx, e)
+		}
+		if err != nil {
+			ctxLogger(ctx).Warn("could not look up whether records are managed by namedyn", "host", hostname, "type", e.Type, "error", err)
+			continue
+		}
+		if len(records) == 0 {
+			ctxLogger(ctx).Info("no existing records, the created ones are marked as managed by namedyn", "host", hostname, "type", e.Type)
+			continue
+		}
+		ids := make([]string, len(records))
+		for i, r := range records {
+			ids[i] = r.ID
+		}
+		if managed {
+			ctxLogger(ctx).Info("existing records are managed by namedyn", "host", hostname, "type", e.Type, "ids", strings.Join(ids, ","))
+			continue
+		}
+		msg := "existing records are not managed by namedyn yet, they are marked once handled"
+		if u.StrictOwnership {
+			msg = "existing records are not managed by namedyn, not changing them with strict ownership"
+		}
+		ctxLogger(ctx).Info(msg, "host", hostname, "type", e.Type, "ids", strings.Join(ids, ","))
+	}
+}
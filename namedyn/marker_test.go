@@ -0,0 +1,146 @@
+package namedyn
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestMarkerHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "", want: "_namedyn"},
+		{host: "home", want: "_namedyn.home"},
+		{host: "a.b", want: "_namedyn.a.b"},
+		{host: "*", want: "_namedyn-wildcard"},
+		{host: "*.home", want: "_namedyn-wildcard.home"},
+	}
+	for _, tt := range tests {
+		if got := markerHost(tt.host); got != tt.want {
+			t.Errorf("markerHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	marker := &Record{Host: "_namedyn.home", Type: "TXT", Answer: "managed-by=namedyn type=A", TTL: 300}
+	tests := []struct {
+		name     string
+		strict   bool
+		existing []*Record
+		// calls are the expected changes.
+		calls []string
+	}{
+		{
+			name:   "strict creates and marks",
+			strict: true,
+			calls: []string{
+				"create home A 203.0.113.1",
+				"create _namedyn.home TXT managed-by=namedyn type=A",
+			},
+		},
+		{
+			name:     "strict leaves unmarked records alone",
+			strict:   true,
+			existing: []*Record{{Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}},
+		},
+		{
+			name:     "strict updates marked records",
+			strict:   true,
+			existing: []*Record{{Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}, marker},
+			calls:    []string{"update home A 203.0.113.1"},
+		},
+		{
+			name:     "strict does not adopt records pointing to the answer",
+			strict:   true,
+			existing: []*Record{{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+		},
+		{
+			name:     "marking updates and marks records",
+			existing: []*Record{{Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}},
+			calls: []string{
+				"update home A 203.0.113.1",
+				"create _namedyn.home TXT managed-by=namedyn type=A",
+			},
+		},
+		{
+			name:     "marking adopts records pointing to the answer",
+			existing: []*Record{{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			calls:    []string{"create _namedyn.home TXT managed-by=namedyn type=A"},
+		},
+		{
+			name:     "marker of another type",
+			existing: []*Record{{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}, {Host: "_namedyn.home", Type: "TXT", Answer: "managed-by=namedyn type=AAAA"}},
+			calls:    []string{"create _namedyn.home TXT managed-by=namedyn type=A"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakeProvider{}
+			for _, r := range tt.existing {
+				c := *r
+				p.nextID++
+				c.ID = strconv.Itoa(p.nextID)
+				p.records = append(p.records, &c)
+			}
+			u := newMarkingUpdater(p, tt.strict)
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(p.calls, tt.calls) {
+				t.Errorf("got calls %q, want %q", p.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestCleanupDeletesMarker(t *testing.T) {
+	p := &fakeProvider{}
+	u := newMarkingUpdater(p, true)
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	u.Cleanup(context.Background())
+	if len(p.records) != 0 {
+		t.Fatalf("got records %v after cleanup, want none", p.records)
+	}
+	// records created by others later are not considered managed
+	p.calls = nil
+	p.records = append(p.records, &Record{ID: "manual", Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300})
+	u = newMarkingUpdater(p, true)
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	if len(p.calls) != 0 || p.records[0].Answer != "198.51.100.1" {
+		t.Errorf("got calls %q and records %v, want the manual record to be left alone", p.calls, p.records)
+	}
+}
+
+func TestCleanupKeepsMarkerOfRemainingRecords(t *testing.T) {
+	p := &fakeProvider{}
+	u := newMarkingUpdater(p, true)
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	// a record which has not been created by this process is not cleaned up
+	p.records = append(p.records, &Record{ID: "other", Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300})
+	u.Cleanup(context.Background())
+	if len(p.records) != 2 || p.records[0].Type != "TXT" || p.records[1].ID != "other" {
+		t.Errorf("got records %v, want the marker and the other record", p.records)
+	}
+}
+
+// newMarkingUpdater returns an updater managing the A record of home.example.com
+// pointing to 203.0.113.1 using the given provider and marking its records.
+func newMarkingUpdater(p Provider, strict bool) *Updater {
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	families := []IPFamily{{Type: "A", Fixed: "203.0.113.1"}}
+	u := NewUpdater(http.DefaultClient, entries, families)
+	u.MarkRecords = !strict
+	u.StrictOwnership = strict
+	return u
+}
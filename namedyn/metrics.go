@@ -0,0 +1,230 @@
+package namedyn
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric families exposed in the prometheus text format.
+var (
+	updatesTotal = newMetricVec("counter", "namedyn_updates_total",
+		"Number of records successfully created, updated or deleted.", "type", "action")
+	errorsTotal = newMetricVec("counter", "namedyn_errors_total",
+		"Number of errors by stage.", "stage")
+	publicIPInfo = newMetricVec("gauge", "namedyn_public_ip_info",
+		"The last seen own public ips.", "type", "ip")
+	unchangedTotal = newMetricVec("counter", "namedyn_unchanged_total",
+		"Number of times a record already pointed to the own public ip or target.", "type")
+	lastSuccessTimestamp = newMetricVec("gauge", "namedyn_last_success_timestamp_seconds",
+		"Unix timestamp of the last successful cycle.")
+	lastCycleTimestamp = newMetricVec("gauge", "namedyn_last_cycle_timestamp_seconds",
+		"Unix timestamp of the last cycle, whether it succeeded or not.")
+	breakerStateGauge = newMetricVec("gauge", "namedyn_circuit_breaker_state",
+		"State of the circuit breakers by provider and domain, 0 if closed, 1 if open and 2 if half-open.", "provider", "domain")
+	requestDuration = newHistogramVec("namedyn_request_duration_seconds",
+		"Duration of the requests to the ip sources, dns providers and notifiers by operation.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "operation")
+)
+
+// metricFamily is a metric family which can be exposed in the prometheus text format.
+type metricFamily interface {
+	write(w io.Writer)
+}
+
+// metricFamilies contains all metric families in the order they are exposed.
+var metricFamilies = []metricFamily{
+	updatesTotal,
+	unchangedTotal,
+	errorsTotal,
+	publicIPInfo,
+	lastSuccessTimestamp,
+	lastCycleTimestamp,
+	breakerStateGauge,
+	requestDuration,
+}
+
+// metricVec is a metric family with one value per combination of label values.
+type metricVec struct {
+	typ    string
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	// values are keyed by the label values joined by a null byte.
+	values map[string]float64
+}
+
+// newMetricVec returns a metric family of the given type, which
+// is either counter or gauge, using the given label names.
+func newMetricVec(typ, name, help string, labels ...string) *metricVec {
+	return &metricVec{
+		typ:    typ,
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+}
+
+// add adds d to the value of the given label values.
+func (m *metricVec) add(d float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[strings.Join(labelValues, "\x00")] += d
+}
+
+// set sets the value of the given label values.
+func (m *metricVec) set(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[strings.Join(labelValues, "\x00")] = v
+}
+
+// replace sets the value of the given label values after removing
+// all values sharing the same first label value, which is useful
+// for info metrics.
+func (m *metricVec) replace(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.values {
+		if strings.SplitN(k, "\x00", 2)[0] == labelValues[0] {
+			delete(m.values, k)
+		}
+	}
+	m.values[strings.Join(labelValues, "\x00")] = v
+}
+
+// write writes the metric family in the prometheus text format to w.
+func (m *metricVec) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %v\n", m.name, formatLabels(m.labels, strings.Split(k, "\x00")), m.values[k])
+	}
+}
+
+// histogramVec is a histogram family with one histogram per combination of label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	// values are keyed by the label values joined by a null byte.
+	values map[string]*histogram
+}
+
+// histogram contains the number of observations per bucket,
+// which are not cumulative, as well as their sum and count.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogramVec returns a histogram family using the given
+// ascending bucket upper bounds and label names.
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+}
+
+// observe records the given value for the given label values.
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := strings.Join(labelValues, "\x00")
+	hist, ok := h.values[k]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hist
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+// write writes the histogram family in the prometheus text format to w.
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		hist := h.values[k]
+		values := strings.Split(k, "\x00")
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %v\n", h.name, formatLabels(names, append(values, strconv.FormatFloat(b, 'g', -1, 64))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %v\n", h.name, formatLabels(names, append(values, "+Inf")), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", h.name, formatLabels(h.labels, values), hist.sum)
+		fmt.Fprintf(w, "%s_count%s %v\n", h.name, formatLabels(h.labels, values), hist.count)
+	}
+}
+
+// timedDo sends the given request using cli and records
+// its duration as the given operation.
+func timedDo(cli Doer, operation string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := cli.Do(req)
+	requestDuration.observe(time.Since(start).Seconds(), operation)
+	return res, err
+}
+
+// formatLabels formats the given label names and values, e.g. {type="A"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, n := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, n, r.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// metricsHandler serves all metric families in the prometheus text format.
+func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metricFamilies {
+		m.write(w)
+	}
+}
+
+// ServeMetrics listens on the given address and serves the metrics in the
+// background. Listening is done synchronously, so errors are returned.
+func ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	return listen(addr, "metrics", mux)
+}
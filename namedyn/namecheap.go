@@ -0,0 +1,141 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NamecheapReply represents the reply of the namecheap dynamic dns api
+// (https://www.namecheap.com/support/knowledgebase/article.aspx/29/11/how-to-dynamically-update-the-hosts-ip-with-an-http-request/).
+type NamecheapReply struct {
+	XMLName  xml.Name `xml:"interface-response"`
+	IP       string   `xml:"IP"`
+	ErrCount int      `xml:"ErrCount"`
+	Errors   struct {
+		Errors []string `xml:",any"`
+	} `xml:"errors"`
+	Done bool `xml:"Done"`
+}
+
+// NamecheapProvider manages the A records of a domain using the namecheap
+// dynamic dns api. The api is only able to set the address of a host, it is
+// neither possible to look up nor to delete records.
+type NamecheapProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://dynamicdns.park-your-domain.com.
+	baseURL string
+	// password is the dynamic dns password of the domain, not the account password.
+	password string
+	domain   string
+}
+
+// NewNamecheapProvider returns a provider managing the A records of the given
+// domain using the namecheap dynamic dns api at baseURL and the given password.
+func NewNamecheapProvider(cli Doer, baseURL, password, domain string) *NamecheapProvider {
+	return &NamecheapProvider{
+		cli:      cli,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		password: password,
+		domain:   domain,
+	}
+}
+
+// FindRecords always returns no records, as the records can not be looked up
+// using the dynamic dns api. The address is therefore set whenever the answer
+// changes or the records are resynced.
+func (p *NamecheapProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	return nil, nil
+}
+
+// writeOnly marks the provider as unable to look up records.
+func (p *NamecheapProvider) writeOnly() {}
+
+// CreateRecord sets the address of the given record.
+func (p *NamecheapProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	if err := p.update(ctx, "create", rec); err != nil {
+		return fmt.Errorf("error while creating dns record using namecheap api: %s", err)
+	}
+	rec.ID = p.name(rec.Host)
+	return nil
+}
+
+// UpdateRecord sets the address of the given record.
+func (p *NamecheapProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if err := p.update(ctx, "update", rec); err != nil {
+		return fmt.Errorf("error while updating dns record using namecheap api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord returns an error, as records can not be deleted using the dynamic dns api.
+func (p *NamecheapProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	return fmt.Errorf("error while deleting dns record using namecheap api: records can not be deleted using the dynamic dns api")
+}
+
+// update sets the address of the host of the given record to its answer.
+// The operation is used by the metrics.
+func (p *NamecheapProvider) update(ctx context.Context, operation string, rec *Record) error {
+	if rec.Type != "A" {
+		return fmt.Errorf("only A records are supported, got %s", rec.Type)
+	}
+	q := url.Values{}
+	q.Set("host", p.name(rec.Host))
+	q.Set("domain", p.domain)
+	q.Set("password", p.password)
+	q.Set("ip", rec.Answer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/update?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		// the error contains the url including the password
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return err
+	}
+	defer res.Body.Close()
+	b, err := readBody(res.Body)
+	if err != nil {
+		return fmt.Errorf("error while reading the reply: %s", err)
+	}
+	if !successful(res) {
+		return fmt.Errorf("unexpected status code %v: %s", res.StatusCode, string(b))
+	}
+	var reply NamecheapReply
+	d := xml.NewDecoder(bytes.NewReader(b))
+	// the reply declares utf-16 but is actually encoded in utf-8
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := d.Decode(&reply); err != nil {
+		return fmt.Errorf("could not decode the reply: %s", err)
+	}
+	if reply.ErrCount > 0 || len(reply.Errors.Errors) > 0 {
+		msg := strings.Join(reply.Errors.Errors, ", ")
+		// namecheap replies with status code 200 even if the password is wrong
+		if strings.Contains(strings.ToLower(msg), "password") {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, msg)
+		}
+		return fmt.Errorf("the update has been rejected: %s", msg)
+	}
+	if !reply.Done {
+		return fmt.Errorf("the update has not been done: %s", string(b))
+	}
+	return nil
+}
+
+// name returns the name of the given host as used by namecheap.
+func (p *NamecheapProvider) name(host string) string {
+	if host == "" {
+		return "@"
+	}
+	return host
+}
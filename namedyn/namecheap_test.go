@@ -0,0 +1,112 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// namecheapReply returns a reply of the namecheap dynamic dns api with the given errors.
+func namecheapReply(errs string, count int) string {
+	done := "true"
+	if count > 0 {
+		done = "false"
+	}
+	// the api declares utf-16 although the reply is encoded in utf-8
+	return `<?xml version="1.0" encoding="utf-16"?>` +
+		`<interface-response><Command>SETDNSHOST</Command><Language>eng</Language><IP>203.0.113.1</IP>` +
+		`<ErrCount>` + strconv.Itoa(count) + `</ErrCount><errors>` + errs + `</errors>` +
+		`<ResponseCount>0</ResponseCount><responses /><Done>` + done + `</Done><debug><![CDATA[]]></debug></interface-response>`
+}
+
+func TestNamecheapUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rec    Record
+		status int
+		reply  string
+		query  url.Values
+		id     string
+		err    error
+	}{
+		{
+			name:  "update",
+			rec:   Record{Host: "home", Type: "A", Answer: "203.0.113.1"},
+			reply: namecheapReply("", 0),
+			query: url.Values{"host": {"home"}, "domain": {"example.com"}, "password": {"secret"}, "ip": {"203.0.113.1"}},
+			id:    "home",
+		},
+		{
+			name:  "root record",
+			rec:   Record{Host: "", Type: "A", Answer: "203.0.113.1"},
+			reply: namecheapReply("", 0),
+			query: url.Values{"host": {"@"}, "domain": {"example.com"}, "password": {"secret"}, "ip": {"203.0.113.1"}},
+			id:    "@",
+		},
+		{
+			name:  "wrong password",
+			rec:   Record{Host: "home", Type: "A", Answer: "203.0.113.1"},
+			reply: namecheapReply("<Err1>Passwords do not match</Err1>", 1),
+			query: url.Values{"host": {"home"}, "domain": {"example.com"}, "password": {"secret"}, "ip": {"203.0.113.1"}},
+			err:   ErrUnauthorized,
+		},
+		{
+			name:  "rejected",
+			rec:   Record{Host: "home", Type: "A", Answer: "203.0.113.1"},
+			reply: namecheapReply("<Err1>Domain name not found</Err1>", 1),
+			query: url.Values{"host": {"home"}, "domain": {"example.com"}, "password": {"secret"}, "ip": {"203.0.113.1"}},
+			err:   errors.New("the update has been rejected: Domain name not found"),
+		},
+		{
+			name:   "server error",
+			rec:    Record{Host: "home", Type: "A", Answer: "203.0.113.1"},
+			status: http.StatusInternalServerError,
+			reply:  "failed",
+			query:  url.Values{"host": {"home"}, "domain": {"example.com"}, "password": {"secret"}, "ip": {"203.0.113.1"}},
+			err:    errors.New("unexpected status code 500: failed"),
+		},
+		{
+			name: "aaaa record",
+			rec:  Record{Host: "home", Type: "AAAA", Answer: "2001:db8::1"},
+			err:  errors.New("only A records are supported, got AAAA"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/update" {
+					http.NotFound(w, r)
+					return
+				}
+				query = r.URL.Query()
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.reply))
+			}))
+			defer srv.Close()
+			p := NewNamecheapProvider(srv.Client(), srv.URL+"/", "secret", "example.com")
+			rec := tt.rec
+			err := p.update(context.Background(), "update", &rec)
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(query, tt.query) {
+				t.Errorf("got query %v, want %v", query, tt.query)
+			}
+			if err != nil {
+				return
+			}
+			if err := p.CreateRecord(context.Background(), &rec); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+		})
+	}
+}
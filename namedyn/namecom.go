@@ -0,0 +1,224 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NameRecord represents the record type from the name.com api
+// (https://www.name.com/api-docs/types/record).
+type NameRecord struct {
+	Id     int32  `json:"id"`
+	Host   string `json:"host"`
+	Type   string `json:"type"`
+	Answer string `json:"answer"`
+	TTL    int32  `json:"ttl"`
+	// Priority is only used by MX and SRV records, it is sent even if it is 0,
+	// as name.com applies its default priority otherwise.
+	Priority *int32 `json:"priority,omitempty"`
+}
+
+// NameListRecordsReply represents the reply while listing
+// records using the name.com api.
+type NameListRecordsReply struct {
+	Records  []NameRecord `json:"records"`
+	NextPage int32        `json:"nextPage"`
+	LastPage int32        `json:"lastPage"`
+}
+
+// NameComProvider manages the records of a domain using the name.com v4 api.
+type NameComProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.name.com/v4.
+	baseURL string
+	// username and token are looked up for every request, as they may be rotated.
+	username Secret
+	token    Secret
+	domain   string
+}
+
+// NewNameComProvider returns a provider managing the records of the given
+// domain using the name.com api at baseURL and the given credentials.
+func NewNameComProvider(cli Doer, baseURL string, username, token Secret, domain string) *NameComProvider {
+	return &NameComProvider{
+		cli:      cli,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		token:    token,
+		domain:   domain,
+	}
+}
+
+// newRequest creates an authenticated request to the given path of the domain's records.
+func (p *NameComProvider) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/domains/%s/records%s", p.baseURL, p.domain, path), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(p.username.Value(), p.token.Value())
+	return req, nil
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *NameComProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	// the records are paginated, so all pages
+	// need to be queried to find all records
+	var records []*Record
+	page := int32(1)
+	for {
+		listReply, err := p.listRecords(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		// search for dns
+		for i := range listReply.Records {
+			// hosts are case insensitive
+			if r := &listReply.Records[i]; strings.EqualFold(r.Host, host) && r.Type == typ {
+				records = append(records, r.record())
+			}
+		}
+		// the next page is zero on the last page
+		if listReply.NextPage <= page {
+			return records, nil
+		}
+		page = listReply.NextPage
+	}
+}
+
+// listRecords returns the given page of the domain's records.
+func (p *NameComProvider) listRecords(ctx context.Context, page int32) (*NameListRecordsReply, error) {
+	req, err := p.newRequest(ctx, http.MethodGet, fmt.Sprintf("?page=%v", page), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request to list dns records using name.com api: %s", err)
+	}
+	res, err := timedDo(p.cli, "list", req)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying list of dns records using name.com api: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		b, _ := readBody(res.Body)
+		return nil, fmt.Errorf("%w with status code %v while listing dns records using name.com api: %s", ErrDomainNotFound, res.StatusCode, string(b))
+	}
+	if err := checkResponse(res); err != nil {
+		return nil, fmt.Errorf("error while listing dns records using name.com api: %w", err)
+	}
+	var listReply NameListRecordsReply
+	err = json.NewDecoder(res.Body).Decode(&listReply)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the reply while listing name.com records: %s", err)
+	}
+	return &listReply, nil
+}
+
+// CreateRecord creates the given record.
+func (p *NameComProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	req, err := p.newRequest(ctx, http.MethodPost, "", newNameRecord(rec))
+	if err != nil {
+		return fmt.Errorf("error while creating request to add dns record using name.com api: %s", err)
+	}
+	res, err := timedDo(p.cli, "create", req)
+	if err != nil {
+		return fmt.Errorf("error while creating dns record using name.com api: %s", err)
+	}
+	defer res.Body.Close()
+	if err := checkResponse(res); err != nil {
+		return fmt.Errorf("error while creating dns record using name.com api: %w", err)
+	}
+	var created NameRecord
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		return fmt.Errorf("could not decode the reply while creating name.com record: %s", err)
+	}
+	rec.ID = strconv.Itoa(int(created.Id))
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *NameComProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	r := newNameRecord(rec)
+	req, err := p.newRequest(ctx, http.MethodPut, fmt.Sprintf("/%v", r.Id), r)
+	if err != nil {
+		return fmt.Errorf("error while creating request to update dns record using name.com api: %s", err)
+	}
+	res, err := timedDo(p.cli, "update", req)
+	if err != nil {
+		return fmt.Errorf("error while updating dns record using name.com api: %s", err)
+	}
+	defer res.Body.Close()
+	if err := checkResponse(res); err != nil {
+		return fmt.Errorf("error while updating dns record using name.com api: %w", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *NameComProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	req, err := p.newRequest(ctx, http.MethodDelete, "/"+rec.ID, nil)
+	if err != nil {
+		return fmt.Errorf("error while creating request to delete dns record using name.com api: %s", err)
+	}
+	res, err := timedDo(p.cli, "delete", req)
+	if err != nil {
+		return fmt.Errorf("error while deleting dns record using name.com api: %s", err)
+	}
+	defer res.Body.Close()
+	if err := checkResponse(res); err != nil {
+		return fmt.Errorf("error while deleting dns record using name.com api: %w", err)
+	}
+	return nil
+}
+
+// newNameRecord converts the given record to a name.com record.
+func newNameRecord(rec *Record) *NameRecord {
+	// the id is empty for records which do not exist yet
+	id, _ := strconv.Atoi(rec.ID)
+	answer := rec.Answer
+	if rec.Type == "SRV" {
+		// the answer of srv records is formatted like "weight port target"
+		answer = fmt.Sprintf("%v %v %s", rec.Weight, rec.Port, rec.Answer)
+	}
+	r := &NameRecord{
+		Id:     int32(id),
+		Host:   rec.Host,
+		Type:   rec.Type,
+		Answer: answer,
+		TTL:    rec.TTL,
+	}
+	if rec.Type == "MX" || rec.Type == "SRV" {
+		priority := rec.Priority
+		r.Priority = &priority
+	}
+	return r
+}
+
+// record converts the name.com record to a provider independent record.
+func (r *NameRecord) record() *Record {
+	rec := &Record{
+		ID:     strconv.Itoa(int(r.Id)),
+		Host:   r.Host,
+		Type:   r.Type,
+		Answer: r.Answer,
+		TTL:    r.TTL,
+	}
+	if r.Priority != nil {
+		rec.Priority = *r.Priority
+	}
+	if f := strings.Fields(r.Answer); r.Type == "SRV" && len(f) == 3 {
+		weight, _ := strconv.Atoi(f[0])
+		port, _ := strconv.Atoi(f[1])
+		rec.Weight, rec.Port, rec.Answer = int32(weight), int32(port), f[2]
+	}
+	return rec
+}
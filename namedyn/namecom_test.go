@@ -0,0 +1,395 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// nameServer is a mock of the name.com api serving the records of example.com.
+type nameServer struct {
+	mu sync.Mutex
+	// pages are the pages of records returned while listing them.
+	pages [][]NameRecord
+	// status contains the status codes replied to the methods, the requests
+	// are only handled if they are successful.
+	status map[string]int
+	// requests contains the requests in order, e.g. "PUT /v4/domains/example.com/records/1 {...}".
+	requests []string
+	nextID   int32
+}
+
+func (s *nameServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+strings.TrimSpace(string(b))))
+	if user, token, ok := r.BasicAuth(); !ok || user != "user" || token != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if status, ok := s.status[r.Method]; ok {
+		w.WriteHeader(status)
+		if !(status >= 200 && status <= 299) {
+			w.Write([]byte(`{"message":"failed"}`))
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		reply := NameListRecordsReply{LastPage: int32(len(s.pages))}
+		if page >= 1 && page <= len(s.pages) {
+			reply.Records = s.pages[page-1]
+		}
+		if page < len(s.pages) {
+			reply.NextPage = int32(page + 1)
+		}
+		json.NewEncoder(w).Encode(reply)
+	case http.MethodPost:
+		var rec NameRecord
+		json.Unmarshal(b, &rec)
+		s.nextID++
+		rec.Id = s.nextID
+		json.NewEncoder(w).Encode(rec)
+	default:
+		w.Write(b)
+	}
+}
+
+// newNameServer starts the given mock and returns a provider using it.
+func newNameServer(t *testing.T, s *nameServer) *NameComProvider {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	if s.nextID == 0 {
+		s.nextID = 100
+	}
+	return NewNameComProvider(srv.Client(), srv.URL+"/v4/", StaticSecret("user"), StaticSecret("token"), "example.com")
+}
+
+func TestNameComFindRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    [][]NameRecord
+		status   map[string]int
+		host     string
+		want     []*Record
+		requests []string
+		err      error
+	}{
+		{
+			name:     "not found",
+			pages:    [][]NameRecord{{{Id: 1, Host: "nas", Type: "A", Answer: "203.0.113.2", TTL: 300}}},
+			host:     "home",
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+		},
+		{
+			name: "type and case insensitive host",
+			pages: [][]NameRecord{{
+				{Id: 1, Host: "HOME", Type: "A", Answer: "203.0.113.1", TTL: 300},
+				{Id: 2, Host: "home", Type: "AAAA", Answer: "2001:db8::1", TTL: 300},
+			}},
+			host:     "home",
+			want:     []*Record{{ID: "1", Host: "HOME", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+		},
+		{
+			name: "pagination",
+			pages: [][]NameRecord{
+				{{Id: 1, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+				{{Id: 2, Host: "nas", Type: "A", Answer: "203.0.113.2", TTL: 300}},
+				{{Id: 3, Host: "home", Type: "A", Answer: "203.0.113.3", TTL: 600}},
+			},
+			host: "home",
+			want: []*Record{
+				{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+				{ID: "3", Host: "home", Type: "A", Answer: "203.0.113.3", TTL: 600},
+			},
+			requests: []string{
+				"GET /v4/domains/example.com/records?page=1",
+				"GET /v4/domains/example.com/records?page=2",
+				"GET /v4/domains/example.com/records?page=3",
+			},
+		},
+		{
+			name:     "apex",
+			pages:    [][]NameRecord{{{Id: 1, Host: "", Type: "A", Answer: "203.0.113.1", TTL: 300}}},
+			want:     []*Record{{ID: "1", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+		},
+		{
+			name:     "list error",
+			status:   map[string]int{http.MethodGet: http.StatusInternalServerError},
+			host:     "home",
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+			err:      errors.New("unexpected status code 500"),
+		},
+		{
+			name:     "domain not found",
+			status:   map[string]int{http.MethodGet: http.StatusNotFound},
+			host:     "home",
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+			err:      ErrDomainNotFound,
+		},
+		{
+			name:     "unauthorized",
+			status:   map[string]int{http.MethodGet: http.StatusUnauthorized},
+			host:     "home",
+			requests: []string{"GET /v4/domains/example.com/records?page=1"},
+			err:      ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{pages: tt.pages, status: tt.status}
+			p := newNameServer(t, s)
+			got, err := p.FindRecords(context.Background(), tt.host, "A")
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestNameComChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		status map[string]int
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		wantID   string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "101",
+			requests: []string{`POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "create srv",
+			op:       "create",
+			rec:      Record{Host: "_sip._tcp", Type: "SRV", Answer: "sip.example.com", TTL: 300, Priority: 10, Weight: 5, Port: 5060},
+			wantID:   "101",
+			requests: []string{`POST /v4/domains/example.com/records {"id":0,"host":"_sip._tcp","type":"SRV","answer":"5 5060 sip.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "create mx with priority 0",
+			op:       "create",
+			rec:      Record{Host: "", Type: "MX", Answer: "mail.example.com", TTL: 300},
+			wantID:   "101",
+			requests: []string{`POST /v4/domains/example.com/records {"id":0,"host":"","type":"MX","answer":"mail.example.com","ttl":300,"priority":0}`},
+		},
+		{
+			name:     "create with status created",
+			status:   map[string]int{http.MethodPost: http.StatusCreated},
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "101",
+			requests: []string{`POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "create error",
+			status:   map[string]int{http.MethodPost: http.StatusUnprocessableEntity},
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			requests: []string{`POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			err:      errors.New("error while creating dns record using name.com api: unexpected status code 422"),
+		},
+		{
+			name:     "update",
+			op:       "update",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+			wantID:   "7",
+			requests: []string{`PUT /v4/domains/example.com/records/7 {"id":7,"host":"home","type":"A","answer":"203.0.113.1","ttl":600}`},
+		},
+		{
+			name:     "update with status no content",
+			status:   map[string]int{http.MethodPut: http.StatusNoContent},
+			op:       "update",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{`PUT /v4/domains/example.com/records/7 {"id":7,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "update error",
+			status:   map[string]int{http.MethodPut: http.StatusInternalServerError},
+			op:       "update",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{`PUT /v4/domains/example.com/records/7 {"id":7,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			err:      errors.New("error while updating dns record using name.com api: unexpected status code 500"),
+		},
+		{
+			name:     "update unauthorized",
+			status:   map[string]int{http.MethodPut: http.StatusForbidden},
+			op:       "update",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{`PUT /v4/domains/example.com/records/7 {"id":7,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			err:      ErrUnauthorized,
+		},
+		{
+			name:     "delete",
+			op:       "delete",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{"DELETE /v4/domains/example.com/records/7"},
+		},
+		{
+			name:     "delete with status no content",
+			status:   map[string]int{http.MethodDelete: http.StatusNoContent},
+			op:       "delete",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{"DELETE /v4/domains/example.com/records/7"},
+		},
+		{
+			name:     "delete error",
+			status:   map[string]int{http.MethodDelete: http.StatusNotFound},
+			op:       "delete",
+			rec:      Record{ID: "7", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			wantID:   "7",
+			requests: []string{"DELETE /v4/domains/example.com/records/7"},
+			err:      errors.New("error while deleting dns record using name.com api: unexpected status code 404"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{status: tt.status}
+			p := newNameServer(t, s)
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.wantID {
+				t.Errorf("got id %q, want %q", rec.ID, tt.wantID)
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+// int32Pointer returns a pointer to the given value.
+func int32Pointer(i int32) *int32 {
+	return &i
+}
+
+func TestNameRecordPriority(t *testing.T) {
+	tests := []struct {
+		name string
+		r    NameRecord
+		want int32
+	}{
+		{name: "priority", r: NameRecord{Id: 1, Type: "MX", Answer: "mail.example.com", TTL: 300, Priority: int32Pointer(10)}, want: 10},
+		{name: "priority 0", r: NameRecord{Id: 1, Type: "MX", Answer: "mail.example.com", TTL: 300, Priority: int32Pointer(0)}, want: 0},
+		{name: "without priority", r: NameRecord{Id: 1, Type: "A", Answer: "203.0.113.1", TTL: 300}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.record()
+			if got.Priority != tt.want {
+				t.Errorf("got priority %v, want %v", got.Priority, tt.want)
+			}
+			// the priority is kept, so a priority of 0 is not omitted
+			if back := newNameRecord(got); !reflect.DeepEqual(*back, tt.r) {
+				t.Errorf("got %+v, want %+v", *back, tt.r)
+			}
+		})
+	}
+}
+
+func TestNameRecordSRV(t *testing.T) {
+	r := NameRecord{Id: 1, Host: "_sip._tcp", Type: "SRV", Answer: "5 5060 sip.example.com", TTL: 300, Priority: int32Pointer(10)}
+	want := &Record{ID: "1", Host: "_sip._tcp", Type: "SRV", Answer: "sip.example.com", TTL: 300, Priority: 10, Weight: 5, Port: 5060}
+	got := r.record()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if back := newNameRecord(got); !reflect.DeepEqual(*back, r) {
+		t.Errorf("got %+v, want %+v", *back, r)
+	}
+}
+
+// checkError reports an error unless err is nil like want, wraps the sentinel
+// want or, for other errors, contains the message of want.
+func checkError(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case err == nil:
+		t.Fatalf("got no error, want %v", want)
+	case want == ErrDomainNotFound || want == ErrUnauthorized:
+		if !errors.Is(err, want) {
+			t.Fatalf("got error %v, want it to wrap %v", err, want)
+		}
+	case !strings.Contains(err.Error(), want.Error()):
+		t.Fatalf("got error %v, want it to contain %q", err, want)
+	}
+}
+
+func TestNameComFindRecordsDoesNotAlias(t *testing.T) {
+	s := &nameServer{pages: [][]NameRecord{{
+		{Id: 1, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+		{Id: 2, Host: "nas", Type: "A", Answer: "203.0.113.2", TTL: 300},
+		{Id: 3, Host: "home", Type: "A", Answer: "203.0.113.3", TTL: 300},
+		{Id: 4, Host: "home", Type: "AAAA", Answer: "2001:db8::4", TTL: 300},
+	}}}
+	p := newNameServer(t, s)
+	got, err := p.FindRecords(context.Background(), "home", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %v records, want 2", len(got))
+	}
+	// every record needs to keep the fields of its own match
+	for i, want := range []struct{ id, answer string }{{"1", "203.0.113.1"}, {"3", "203.0.113.3"}} {
+		if got[i].ID != want.id || got[i].Answer != want.answer {
+			t.Errorf("record %v: got id %s and answer %s, want %s and %s", i, got[i].ID, got[i].Answer, want.id, want.answer)
+		}
+	}
+	if got[0] == got[1] {
+		t.Error("the records share the same pointer")
+	}
+}
+
+func TestNameComListErrorContainsBody(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusInternalServerError} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			p := newNameServer(t, &nameServer{status: map[string]int{http.MethodGet: status}})
+			_, err := p.FindRecords(context.Background(), "home", "A")
+			// the error body must not be decoded as a list of records
+			if err == nil || !strings.Contains(err.Error(), `{"message":"failed"}`) || !strings.Contains(err.Error(), strconv.Itoa(status)) {
+				t.Errorf("got error %v, want it to contain the status code and the body of the reply", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Change describes a record which has been created, updated or deleted.
+type Change struct {
+	Host string `json:"host"`
+	Type string `json:"type"`
+	// OldIP is empty if the record has been created.
+	OldIP string `json:"old_ip"`
+	// NewIP is empty if the record has been deleted.
+	NewIP string    `json:"new_ip"`
+	Time  time.Time `json:"timestamp"`
+}
+
+// String returns a human readable summary of the change.
+func (c Change) String() string {
+	if c.OldIP == "" {
+		return fmt.Sprintf("created %s record %s with ip %s", c.Type, c.Host, c.NewIP)
+	}
+	if c.NewIP == "" {
+		return fmt.Sprintf("deleted %s record %s with ip %s", c.Type, c.Host, c.OldIP)
+	}
+	return fmt.Sprintf("updated %s record %s, changed ip from %s to %s", c.Type, c.Host, c.OldIP, c.NewIP)
+}
+
+// Notifier is implemented by the services which get notified about changes.
+type Notifier interface {
+	Notify(ctx context.Context, c Change) error
+}
+
+// Alert describes a record which failed repeatedly.
+type Alert struct {
+	Host     string    `json:"host"`
+	Type     string    `json:"type"`
+	Failures int       `json:"failures"`
+	Time     time.Time `json:"timestamp"`
+}
+
+// String returns a human readable summary of the alert.
+func (a Alert) String() string {
+	return fmt.Sprintf("%s record %s failed %v times in a row", a.Type, a.Host, a.Failures)
+}
+
+// Alerter is implemented by the notifiers which get alerted about failures.
+type Alerter interface {
+	Alert(ctx context.Context, a Alert) error
+}
+
+// WebhookNotifier posts changes as json to a webhook.
+type WebhookNotifier struct {
+	cli Doer
+	url string
+}
+
+// NewWebhookNotifier returns a notifier posting changes to the given url.
+func NewWebhookNotifier(cli Doer, url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		cli: cli,
+		url: url,
+	}
+}
+
+// Notify posts the given change to the webhook.
+func (n *WebhookNotifier) Notify(ctx context.Context, c Change) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("error while creating webhook request body: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error while creating webhook request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := timedDo(n.cli, "notify", req)
+	if err != nil {
+		return fmt.Errorf("error while calling webhook: %s", err)
+	}
+	defer res.Body.Close()
+	if !successful(res) {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("unexpected status code %v while calling webhook: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
+
+// redact replaces all occurrences of the given secret in s.
+func redact(s, secret string) string {
+	if secret == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, secret, "REDACTED")
+}
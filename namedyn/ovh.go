@@ -0,0 +1,214 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OVHRecord represents the zone record type from the ovh api
+// (https://eu.api.ovh.com/console/#/domain/zone/%7BzoneName%7D/record).
+type OVHRecord struct {
+	Id        int64  `json:"id,omitempty"`
+	FieldType string `json:"fieldType,omitempty"`
+	// SubDomain is relative to the zone, it is empty for the root record.
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int32  `json:"ttl"`
+}
+
+// OVHProvider manages the records of a zone using the ovh api.
+type OVHProvider struct {
+	cli Doer
+	// baseURL is the url of the api endpoint, e.g. https://eu.api.ovh.com/1.0.
+	baseURL        string
+	appKey         string
+	appSecret      string
+	consumerKey    string
+	domain         string
+	mu             sync.Mutex
+	timeDelta      time.Duration
+	timeDeltaKnown bool
+}
+
+// NewOVHProvider returns a provider managing the records of the given domain
+// using the ovh api at baseURL, authenticated by the given application key,
+// application secret and consumer key.
+func NewOVHProvider(cli Doer, baseURL, appKey, appSecret, consumerKey, domain string) *OVHProvider {
+	return &OVHProvider{
+		cli:         cli,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		appKey:      appKey,
+		appSecret:   appSecret,
+		consumerKey: consumerKey,
+		domain:      domain,
+	}
+}
+
+// now returns the current time of the ovh api, which is required to sign the
+// requests. The offset to the local clock is looked up once.
+func (p *OVHProvider) now(ctx context.Context) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.timeDeltaKnown {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/auth/time", nil)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error while creating request: %s", err)
+		}
+		res, err := timedDo(p.cli, "auth", req)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error while looking up ovh api time: %s", err)
+		}
+		defer res.Body.Close()
+		b, err := readBody(res.Body)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error while reading ovh api time: %s", err)
+		}
+		if !successful(res) {
+			return time.Time{}, fmt.Errorf("unexpected status code %v while looking up ovh api time: %s", res.StatusCode, string(b))
+		}
+		ts, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse ovh api time %q: %s", string(b), err)
+		}
+		p.timeDelta = time.Until(time.Unix(ts, 0))
+		p.timeDeltaKnown = true
+	}
+	return time.Now().Add(p.timeDelta), nil
+}
+
+// do sends a signed request to the given path of the zone and decodes
+// the reply into v. The operation is used by the metrics.
+func (p *OVHProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	now, err := p.now(ctx)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if body != nil {
+		if b, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	u := fmt.Sprintf("%s/domain/zone/%s%s", p.baseURL, url.PathEscape(p.domain), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	// the signature covers the secrets, the request and the timestamp
+	// (https://help.ovhcloud.com/csm/en-api-getting-started-ovhcloud-api)
+	sum := sha1.Sum([]byte(strings.Join([]string{p.appSecret, p.consumerKey, method, u, string(b), ts}, "+")))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ovh-Application", p.appKey)
+	req.Header.Set("X-Ovh-Consumer", p.consumerKey)
+	req.Header.Set("X-Ovh-Timestamp", ts)
+	req.Header.Set("X-Ovh-Signature", "$1$"+hex.EncodeToString(sum[:]))
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound && operation == "list" {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("%w: the ovh zone %s does not exist: %s", ErrDomainNotFound, p.domain, string(b))
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// refresh applies the changed records of the zone, they are
+// not published by the name servers of ovh until then.
+func (p *OVHProvider) refresh(ctx context.Context) error {
+	if err := p.do(ctx, "update", http.MethodPost, "/refresh", nil, nil); err != nil {
+		return fmt.Errorf("error while refreshing ovh zone %s: %s", p.domain, err)
+	}
+	return nil
+}
+
+// FindRecords searches for the host records of the given type. The ids of
+// the records are listed first, every record is queried by its id.
+func (p *OVHProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	q := url.Values{}
+	q.Set("fieldType", typ)
+	// the root record can not be filtered, as an empty
+	// sub domain matches all records of the zone
+	if host != "" {
+		q.Set("subDomain", host)
+	}
+	var ids []int64
+	if err := p.do(ctx, "list", http.MethodGet, "/record?"+q.Encode(), nil, &ids); err != nil {
+		return nil, fmt.Errorf("error while listing dns records using ovh api: %w", err)
+	}
+	var records []*Record
+	for _, id := range ids {
+		var r OVHRecord
+		if err := p.do(ctx, "list", http.MethodGet, fmt.Sprintf("/record/%v", id), nil, &r); err != nil {
+			return nil, fmt.Errorf("error while reading dns record %v using ovh api: %w", id, err)
+		}
+		if strings.EqualFold(r.SubDomain, host) && r.FieldType == typ {
+			records = append(records, &Record{
+				ID:     strconv.FormatInt(r.Id, 10),
+				Host:   host,
+				Type:   r.FieldType,
+				Answer: rrsetAnswer(r.FieldType, r.Target),
+				TTL:    r.TTL,
+			})
+		}
+	}
+	return records, nil
+}
+
+// CreateRecord creates the given record and refreshes the zone.
+func (p *OVHProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	r := ovhRecord(rec)
+	r.FieldType = rec.Type
+	var reply OVHRecord
+	if err := p.do(ctx, "create", http.MethodPost, "/record", r, &reply); err != nil {
+		return fmt.Errorf("error while creating dns record using ovh api: %s", err)
+	}
+	rec.ID = strconv.FormatInt(reply.Id, 10)
+	return p.refresh(ctx)
+}
+
+// UpdateRecord updates the given existing record and refreshes the zone.
+func (p *OVHProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	// the type of a record can not be changed
+	if err := p.do(ctx, "update", http.MethodPut, "/record/"+rec.ID, ovhRecord(rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using ovh api: %s", err)
+	}
+	return p.refresh(ctx)
+}
+
+// DeleteRecord deletes the given existing record and refreshes the zone.
+func (p *OVHProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.do(ctx, "delete", http.MethodDelete, "/record/"+rec.ID, nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using ovh api: %s", err)
+	}
+	return p.refresh(ctx)
+}
+
+// ovhRecord converts the given record to an ovh record without its type.
+func ovhRecord(rec *Record) *OVHRecord {
+	return &OVHRecord{
+		SubDomain: rec.Host,
+		Target:    rrsetValue(rec.Type, rec.Answer),
+		TTL:       rec.TTL,
+	}
+}
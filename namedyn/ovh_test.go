@@ -0,0 +1,310 @@
+package namedyn
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ovhOffset is the offset of the clock of the ovh mock.
+const ovhOffset = time.Hour
+
+// ovhTime is the request looking up the time of the ovh api before signing the first request.
+const ovhTime = "GET /1.0/auth/time"
+
+// ovhAPI returns a mock of the ovh api managing the given records of the zone example.com.
+// Its clock is an hour ahead, so the requests need to be signed using its time.
+func ovhAPI(records ...OVHRecord) *apiServer {
+	return &apiServer{
+		auth: func(w http.ResponseWriter, r *http.Request, b []byte) bool {
+			// the time is looked up without signing the request
+			if r.URL.Path == "/1.0/auth/time" {
+				return true
+			}
+			if err := ovhVerify(r, b); err != nil {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"errorCode":"INVALID_SIGNATURE","message":%q}`, err.Error())
+				return false
+			}
+			return true
+		},
+		failed: `{"message":"failed"}`,
+		handle: func(w http.ResponseWriter, r *http.Request, b []byte) {
+			if r.URL.Path == "/1.0/auth/time" {
+				fmt.Fprint(w, time.Now().Add(ovhOffset).Unix())
+				return
+			}
+			if !strings.HasPrefix(r.URL.Path, "/1.0/domain/zone/example.com/") {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":"This service does not exist"}`))
+				return
+			}
+			path := strings.TrimPrefix(r.URL.Path, "/1.0/domain/zone/example.com")
+			switch {
+			case r.Method == http.MethodGet && path == "/record":
+				ids := []int64{}
+				for _, rec := range records {
+					if rec.FieldType == r.URL.Query().Get("fieldType") && (r.URL.Query().Get("subDomain") == "" || rec.SubDomain == r.URL.Query().Get("subDomain")) {
+						ids = append(ids, rec.Id)
+					}
+				}
+				json.NewEncoder(w).Encode(ids)
+			case r.Method == http.MethodGet && strings.HasPrefix(path, "/record/"):
+				id, _ := strconv.ParseInt(strings.TrimPrefix(path, "/record/"), 10, 64)
+				for _, rec := range records {
+					if rec.Id == id {
+						json.NewEncoder(w).Encode(rec)
+						return
+					}
+				}
+				http.NotFound(w, r)
+			case r.Method == http.MethodPost && path == "/record":
+				var rec OVHRecord
+				json.Unmarshal(b, &rec)
+				rec.Id = 3
+				json.NewEncoder(w).Encode(rec)
+			case r.Method == http.MethodPost && path == "/refresh", r.Method == http.MethodPut, r.Method == http.MethodDelete:
+				w.Write([]byte("null"))
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	}
+}
+
+// ovhVerify checks the signature of the given request with the given body
+// as described by https://help.ovhcloud.com/csm/en-api-getting-started-ovhcloud-api.
+func ovhVerify(r *http.Request, body []byte) error {
+	if r.Header.Get("X-Ovh-Application") != "app" || r.Header.Get("X-Ovh-Consumer") != "consumer" {
+		return errors.New("invalid application or consumer key")
+	}
+	ts := r.Header.Get("X-Ovh-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", ts)
+	}
+	if d := time.Since(time.Unix(sec, 0).Add(-ovhOffset)); d < -5*time.Second || d > 5*time.Second {
+		return fmt.Errorf("timestamp %v is not the time of the api", ts)
+	}
+	sum := sha1.Sum([]byte("secret+consumer+" + r.Method + "+http://" + r.Host + r.URL.RequestURI() + "+" + string(body) + "+" + ts))
+	if got, want := r.Header.Get("X-Ovh-Signature"), "$1$"+hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("got signature %s, want %s", got, want)
+	}
+	return nil
+}
+
+func TestOVHFindRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         *apiServer
+		appSecret string
+		domain    string
+		host      string
+		typ       string
+		want      []*Record
+		requests  []string
+		err       error
+	}{
+		{
+			name: "records",
+			s: ovhAPI(
+				OVHRecord{Id: 1, FieldType: "A", SubDomain: "home", Target: "203.0.113.1", TTL: 300},
+				OVHRecord{Id: 2, FieldType: "A", SubDomain: "nas", Target: "203.0.113.2", TTL: 300},
+				OVHRecord{Id: 3, FieldType: "A", SubDomain: "home", Target: "203.0.113.3", TTL: 60},
+			),
+			host: "home",
+			typ:  "A",
+			want: []*Record{
+				{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+				{ID: "3", Host: "home", Type: "A", Answer: "203.0.113.3", TTL: 60},
+			},
+			requests: []string{
+				ovhTime,
+				"GET /1.0/domain/zone/example.com/record?fieldType=A&subDomain=home",
+				"GET /1.0/domain/zone/example.com/record/1",
+				"GET /1.0/domain/zone/example.com/record/3",
+			},
+		},
+		{
+			name: "root record",
+			s: ovhAPI(
+				OVHRecord{Id: 1, FieldType: "CNAME", SubDomain: "www", Target: "other.example.net.", TTL: 300},
+				OVHRecord{Id: 2, FieldType: "CNAME", SubDomain: "", Target: "target.example.net.", TTL: 300},
+			),
+			typ:  "CNAME",
+			want: []*Record{{ID: "2", Host: "", Type: "CNAME", Answer: "target.example.net", TTL: 300}},
+			// the records of the other sub domains are listed as well
+			requests: []string{
+				ovhTime,
+				"GET /1.0/domain/zone/example.com/record?fieldType=CNAME",
+				"GET /1.0/domain/zone/example.com/record/1",
+				"GET /1.0/domain/zone/example.com/record/2",
+			},
+		},
+		{
+			name:     "zone not found",
+			s:        ovhAPI(),
+			domain:   "example.org",
+			host:     "home",
+			typ:      "A",
+			requests: []string{ovhTime, "GET /1.0/domain/zone/example.org/record?fieldType=A&subDomain=home"},
+			err:      ErrDomainNotFound,
+		},
+		{
+			name:      "invalid signature",
+			s:         ovhAPI(),
+			appSecret: "wrong",
+			host:      "home",
+			typ:       "A",
+			requests:  []string{ovhTime, "GET /1.0/domain/zone/example.com/record?fieldType=A&subDomain=home"},
+			err:       ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appSecret := tt.appSecret
+			if appSecret == "" {
+				appSecret = "secret"
+			}
+			domain := tt.domain
+			if domain == "" {
+				domain = "example.com"
+			}
+			srv := tt.s.start(t)
+			p := NewOVHProvider(srv.Client(), srv.URL+"/1.0/", "app", appSecret, "consumer", domain)
+			got, err := p.FindRecords(context.Background(), tt.host, tt.typ)
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestOVHChanges(t *testing.T) {
+	refresh := "POST /1.0/domain/zone/example.com/refresh"
+	tests := []struct {
+		name string
+		s    *apiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		id       string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			s:        ovhAPI(),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "3",
+			requests: []string{ovhTime, `POST /1.0/domain/zone/example.com/record {"fieldType":"A","subDomain":"home","target":"203.0.113.1","ttl":300}`, refresh},
+		},
+		{
+			name:     "update cname record",
+			s:        ovhAPI(),
+			op:       "update",
+			rec:      Record{ID: "1", Host: "www", Type: "CNAME", Answer: "target.example.net", TTL: 300},
+			id:       "1",
+			requests: []string{ovhTime, `PUT /1.0/domain/zone/example.com/record/1 {"subDomain":"www","target":"target.example.net.","ttl":300}`, refresh},
+		},
+		{
+			name:     "delete",
+			s:        ovhAPI(),
+			op:       "delete",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{ovhTime, "DELETE /1.0/domain/zone/example.com/record/1", refresh},
+		},
+		{
+			name:     "delete rejected",
+			s:        ovhAPI().fail(http.MethodDelete, http.StatusNotFound),
+			op:       "delete",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{ovhTime, "DELETE /1.0/domain/zone/example.com/record/1"},
+			err:      errors.New(`error while deleting dns record using ovh api: unexpected status code 404: {"message":"failed"}`),
+		},
+		{
+			name:     "refresh failed",
+			s:        ovhAPI().fail(http.MethodPost, http.StatusInternalServerError),
+			op:       "update",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "1",
+			requests: []string{ovhTime, `PUT /1.0/domain/zone/example.com/record/1 {"subDomain":"home","target":"203.0.113.1","ttl":300}`, refresh},
+			err:      errors.New("error while refreshing ovh zone example.com: unexpected status code 500"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.s.start(t)
+			p := NewOVHProvider(srv.Client(), srv.URL+"/1.0/", "app", "secret", "consumer", "example.com")
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestOVHSignature(t *testing.T) {
+	var header http.Header
+	var uri string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1.0/auth/time" {
+			// the signature uses the time of the api instead of the local clock
+			w.Write([]byte("1594684800"))
+			return
+		}
+		header, uri = r.Header, r.URL.RequestURI()
+		w.Write([]byte("null"))
+	}))
+	defer srv.Close()
+	p := NewOVHProvider(srv.Client(), srv.URL+"/1.0", "app", "secret", "consumer", "example.com")
+	rec := &Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}
+	if err := p.DeleteRecord(context.Background(), rec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if uri != "/1.0/domain/zone/example.com/refresh" {
+		t.Fatalf("got request %s, want the zone to be refreshed last", uri)
+	}
+	// the timestamp may have advanced by a second while sending the requests
+	ts := header.Get("X-Ovh-Timestamp")
+	if ts != "1594684800" && ts != "1594684801" {
+		t.Fatalf("got timestamp %s, want the time of the api", ts)
+	}
+	sum := sha1.Sum([]byte("secret+consumer+POST+" + srv.URL + uri + "++" + ts))
+	if got, want := header.Get("X-Ovh-Signature"), "$1$"+hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("got signature %s, want %s", got, want)
+	}
+	if header.Get("X-Ovh-Application") != "app" || header.Get("X-Ovh-Consumer") != "consumer" {
+		t.Errorf("got headers %v, want the application and consumer key", header)
+	}
+}
@@ -0,0 +1,162 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PorkbunRecord represents the dns record type from the porkbun api
+// (https://porkbun.com/api/json/v3/documentation).
+type PorkbunRecord struct {
+	Id json.Number `json:"id,omitempty"`
+	// Name is the fully qualified name when retrieving records,
+	// but the subdomain when creating or editing them.
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	// TTL is returned as string.
+	TTL json.Number `json:"ttl"`
+}
+
+// PorkbunReply represents the reply from the porkbun api.
+type PorkbunReply struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Id      json.Number     `json:"id"`
+	Records []PorkbunRecord `json:"records"`
+}
+
+// PorkbunProvider manages the records of a domain using the porkbun v3 api.
+type PorkbunProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.porkbun.com/api/json/v3.
+	baseURL   string
+	apiKey    string
+	secretKey string
+	domain    string
+}
+
+// NewPorkbunProvider returns a provider managing the records of the given
+// domain using the porkbun api at baseURL and the given keys.
+func NewPorkbunProvider(cli Doer, baseURL, apiKey, secretKey, domain string) *PorkbunProvider {
+	return &PorkbunProvider{
+		cli:       cli,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    apiKey,
+		secretKey: secretKey,
+		domain:    domain,
+	}
+}
+
+// do sends a request with the given record to the given path of the porkbun
+// api and returns the reply. All requests are posted and authenticated by the
+// keys in the body. The operation is used by the metrics.
+func (p *PorkbunProvider) do(ctx context.Context, operation, path string, rec *PorkbunRecord) (*PorkbunReply, error) {
+	body := map[string]string{
+		"apikey":       p.apiKey,
+		"secretapikey": p.secretKey,
+	}
+	if rec != nil {
+		body["name"] = rec.Name
+		body["type"] = rec.Type
+		body["content"] = rec.Content
+		body["ttl"] = rec.TTL.String()
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("error while creating request body: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	// the reply contains the records, which may exceed maxBodySize
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading the reply: %s", err)
+	}
+	var reply PorkbunReply
+	if err := json.Unmarshal(b, &reply); err != nil {
+		return nil, fmt.Errorf("could not decode the reply with status code %v: %s", res.StatusCode, string(b))
+	}
+	if unauthorized(res) {
+		return nil, fmt.Errorf("%w with status code %v: %s", ErrUnauthorized, res.StatusCode, reply.Message)
+	}
+	if !successful(res) || reply.Status != "SUCCESS" {
+		return nil, fmt.Errorf("unexpected status code %v: %s", res.StatusCode, reply.Message)
+	}
+	return &reply, nil
+}
+
+// FindRecords searches for the host records of the given type.
+func (p *PorkbunProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	// the lookup is posted as well, but can be retried safely
+	reply, err := p.do(withIdempotent(ctx), "list", fmt.Sprintf("/dns/retrieveByNameType/%s/%s/%s", p.domain, typ, host), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing dns records using porkbun api: %w", err)
+	}
+	var records []*Record
+	for _, r := range reply.Records {
+		ttl, _ := strconv.ParseInt(r.TTL.String(), 10, 32)
+		records = append(records, &Record{
+			ID:     r.Id.String(),
+			Host:   host,
+			Type:   r.Type,
+			Answer: r.Content,
+			TTL:    int32(ttl),
+		})
+	}
+	return records, nil
+}
+
+// CreateRecord creates the given record.
+func (p *PorkbunProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	reply, err := p.do(ctx, "create", "/dns/create/"+p.domain, porkbunRecord(rec))
+	if err != nil {
+		return fmt.Errorf("error while creating dns record using porkbun api: %s", err)
+	}
+	rec.ID = reply.Id.String()
+	return nil
+}
+
+// UpdateRecord updates the given existing record. The record is edited by its
+// id instead of its name and type, so other records of the host are left alone.
+// Editing it again has no further effect, so the request is retried like
+// idempotent requests.
+func (p *PorkbunProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if _, err := p.do(withIdempotent(ctx), "update", fmt.Sprintf("/dns/edit/%s/%s", p.domain, rec.ID), porkbunRecord(rec)); err != nil {
+		return fmt.Errorf("error while updating dns record using porkbun api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *PorkbunProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if _, err := p.do(ctx, "delete", fmt.Sprintf("/dns/delete/%s/%s", p.domain, rec.ID), nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using porkbun api: %s", err)
+	}
+	return nil
+}
+
+// porkbunRecord converts the given record to a porkbun record.
+func porkbunRecord(rec *Record) *PorkbunRecord {
+	return &PorkbunRecord{
+		Name:    rec.Host,
+		Type:    rec.Type,
+		Content: rec.Answer,
+		TTL:     json.Number(strconv.Itoa(int(rec.TTL))),
+	}
+}
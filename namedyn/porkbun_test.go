@@ -0,0 +1,216 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// porkbunAPI returns a mock of the porkbun api managing the given records of example.com.
+func porkbunAPI(records ...PorkbunRecord) *apiServer {
+	return &apiServer{
+		auth: func(w http.ResponseWriter, r *http.Request, b []byte) bool {
+			var body map[string]string
+			json.Unmarshal(b, &body)
+			if body["apikey"] == "key" && body["secretapikey"] == "secret" {
+				return true
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"status":"ERROR","message":"Invalid API key."}`))
+			return false
+		},
+		failed: `{"status":"ERROR","message":"failed"}`,
+		handle: func(w http.ResponseWriter, r *http.Request, b []byte) {
+			switch {
+			case r.Method != http.MethodPost:
+				http.Error(w, "unexpected method "+r.Method, http.StatusMethodNotAllowed)
+			case strings.HasPrefix(r.URL.Path, "/dns/retrieveByNameType/example.com/"):
+				parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/dns/retrieveByNameType/example.com/"), "/")
+				name := "example.com"
+				if len(parts) > 1 && parts[1] != "" {
+					name = parts[1] + ".example.com"
+				}
+				found := []PorkbunRecord{}
+				for _, rec := range records {
+					if rec.Name == name && rec.Type == parts[0] {
+						found = append(found, rec)
+					}
+				}
+				json.NewEncoder(w).Encode(PorkbunReply{Status: "SUCCESS", Records: found})
+			case strings.HasPrefix(r.URL.Path, "/dns/create/example.com"):
+				w.Write([]byte(`{"status":"SUCCESS","id":106926659}`))
+			default:
+				w.Write([]byte(`{"status":"SUCCESS"}`))
+			}
+		},
+	}
+}
+
+func TestPorkbunFindRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         *apiServer
+		secretKey string
+		host      string
+		want      []*Record
+		requests  []string
+		err       error
+	}{
+		{
+			name: "records",
+			s: porkbunAPI(
+				PorkbunRecord{Id: "1", Name: "home.example.com", Type: "A", Content: "203.0.113.1", TTL: "600"},
+				PorkbunRecord{Id: "2", Name: "nas.example.com", Type: "A", Content: "203.0.113.2", TTL: "600"},
+				PorkbunRecord{Id: "3", Name: "home.example.com", Type: "A", Content: "203.0.113.3", TTL: "3600"},
+			),
+			host: "home",
+			want: []*Record{
+				{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+				{ID: "3", Host: "home", Type: "A", Answer: "203.0.113.3", TTL: 3600},
+			},
+			requests: []string{`POST /dns/retrieveByNameType/example.com/A/home {"apikey":"key","secretapikey":"secret"}`},
+		},
+		{
+			name:     "root record",
+			s:        porkbunAPI(PorkbunRecord{Id: "1", Name: "example.com", Type: "A", Content: "203.0.113.1", TTL: "600"}),
+			want:     []*Record{{ID: "1", Host: "", Type: "A", Answer: "203.0.113.1", TTL: 600}},
+			requests: []string{`POST /dns/retrieveByNameType/example.com/A/ {"apikey":"key","secretapikey":"secret"}`},
+		},
+		{
+			name:     "not found",
+			s:        porkbunAPI(),
+			host:     "home",
+			requests: []string{`POST /dns/retrieveByNameType/example.com/A/home {"apikey":"key","secretapikey":"secret"}`},
+		},
+		{
+			name:      "invalid keys",
+			s:         porkbunAPI(),
+			secretKey: "wrong",
+			host:      "home",
+			requests:  []string{`POST /dns/retrieveByNameType/example.com/A/home {"apikey":"key","secretapikey":"wrong"}`},
+			err:       ErrUnauthorized,
+		},
+		{
+			name:     "error reply",
+			s:        porkbunAPI().fail(http.MethodPost, http.StatusBadRequest),
+			host:     "home",
+			requests: []string{`POST /dns/retrieveByNameType/example.com/A/home {"apikey":"key","secretapikey":"secret"}`},
+			err:      errors.New("error while listing dns records using porkbun api: unexpected status code 400: failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretKey := tt.secretKey
+			if secretKey == "" {
+				secretKey = "secret"
+			}
+			srv := tt.s.start(t)
+			p := NewPorkbunProvider(srv.Client(), srv.URL+"/", "key", secretKey, "example.com")
+			got, err := p.FindRecords(context.Background(), tt.host, "A")
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestPorkbunChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *apiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		id       string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			s:        porkbunAPI(),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+			id:       "106926659",
+			requests: []string{`POST /dns/create/example.com {"apikey":"key","content":"203.0.113.1","name":"home","secretapikey":"secret","ttl":"600","type":"A"}`},
+		},
+		{
+			name:     "update",
+			s:        porkbunAPI(),
+			op:       "update",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+			id:       "1",
+			requests: []string{`POST /dns/edit/example.com/1 {"apikey":"key","content":"203.0.113.1","name":"home","secretapikey":"secret","ttl":"600","type":"A"}`},
+		},
+		{
+			name:     "delete",
+			s:        porkbunAPI(),
+			op:       "delete",
+			rec:      Record{ID: "1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+			id:       "1",
+			requests: []string{`POST /dns/delete/example.com/1 {"apikey":"key","secretapikey":"secret"}`},
+		},
+		{
+			name:     "create rejected",
+			s:        porkbunAPI().fail(http.MethodPost, http.StatusBadRequest),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600},
+			requests: []string{`POST /dns/create/example.com {"apikey":"key","content":"203.0.113.1","name":"home","secretapikey":"secret","ttl":"600","type":"A"}`},
+			err:      errors.New("error while creating dns record using porkbun api: unexpected status code 400: failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.s.start(t)
+			p := NewPorkbunProvider(srv.Client(), srv.URL+"/", "key", "secret", "example.com")
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestPorkbunRetriesLookups(t *testing.T) {
+	// the lookup is posted, but retried like idempotent requests
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"status":"SUCCESS","records":[]}`)
+	}))
+	defer srv.Close()
+	cli := &http.Client{Transport: &RetryTransport{Base: http.DefaultTransport, MaxRetries: 2}}
+	p := NewPorkbunProvider(cli, srv.URL, "key", "secret", "example.com")
+	if _, err := p.FindRecords(context.Background(), "home", "A"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %v attempts, want 2", attempts)
+	}
+}
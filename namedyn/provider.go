@@ -0,0 +1,141 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Record represents a dns record independent of the provider managing it.
+type Record struct {
+	// ID is the provider specific identifier of the record.
+	ID     string
+	Host   string
+	Type   string
+	Answer string
+	TTL    int32
+	// Priority is the preference of MX and SRV records, it is zero for other types.
+	Priority int32
+	// Weight and Port are only used by SRV records, Answer is their target.
+	Weight int32
+	Port   int32
+	// Options contains provider specific settings of the record, e.g.
+	// proxied for cloudflare. Providers ignore the options they do not
+	// know and they are only applied when records are created or updated.
+	Options map[string]string
+}
+
+// Provider is implemented by the dns providers which are able to
+// manage the dynamic records.
+type Provider interface {
+	// FindRecords returns all records of the given host and type,
+	// which is empty if no such record exists.
+	FindRecords(ctx context.Context, host, typ string) ([]*Record, error)
+	// CreateRecord creates the given record and sets its ID.
+	CreateRecord(ctx context.Context, rec *Record) error
+	// UpdateRecord updates the given existing record.
+	UpdateRecord(ctx context.Context, rec *Record) error
+	// DeleteRecord deletes the given existing record.
+	DeleteRecord(ctx context.Context, rec *Record) error
+}
+
+// ProviderName returns the name of the given provider, e.g. namecom
+// for *NameComProvider.
+func ProviderName(p Provider) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", p), "*namedyn."), "Provider"))
+}
+
+// settingsApplier is implemented by providers which change the settings of
+// the records on their own, e.g. cloudflare uses the automatic ttl for proxied
+// records. The records found are compared with the settings returned by applied
+// for records of the given type instead of the configured ones, so they are not
+// updated again every cycle.
+type settingsApplier interface {
+	applied(typ string, ttl int32, options map[string]string) (int32, map[string]string)
+}
+
+// writeOnlyProvider is implemented by providers which are unable to look up
+// records, so they never find any and the records are set again whenever
+// they are resynced.
+type writeOnlyProvider interface {
+	writeOnly()
+}
+
+// Doer sends http requests, it is implemented by *http.Client
+// and allows to replace the client, e.g. in tests.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ErrUnauthorized is returned by the providers if their api rejected the credentials.
+var ErrUnauthorized = errors.New("the credentials have been rejected")
+
+// ErrDomainNotFound is returned by the providers if the domain does not exist
+// or is not managed by the account, which is usually a typo in the configuration.
+var ErrDomainNotFound = errors.New("the domain has not been found")
+
+// unauthorized returns true if the response indicates invalid credentials.
+func unauthorized(res *http.Response) bool {
+	return res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden
+}
+
+// maxBodySize limits the size of the response bodies which are read as a
+// whole, e.g. of ip echo services or to report errors, so misbehaving
+// servers are not able to exhaust the memory.
+const maxBodySize = 4 << 10
+
+// readBody reads the given response body up to maxBodySize, the rest is ignored.
+func readBody(r io.Reader) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, maxBodySize))
+}
+
+// successful returns true if the response has a 2xx status code.
+func successful(res *http.Response) bool {
+	return res.StatusCode >= 200 && res.StatusCode <= 299
+}
+
+// checkResponse returns nil if the response has a 2xx status code. Otherwise,
+// it returns an error containing the status code and the start of the body,
+// which wraps ErrUnauthorized if the credentials have been rejected.
+func checkResponse(res *http.Response) error {
+	if successful(res) {
+		return nil
+	}
+	b, _ := readBody(res.Body)
+	if unauthorized(res) {
+		return fmt.Errorf("%w with status code %v: %s", ErrUnauthorized, res.StatusCode, string(b))
+	}
+	return fmt.Errorf("unexpected status code %v: %s", res.StatusCode, string(b))
+}
+
+// rrsetValue returns the value of a resource record for the given answer as
+// used by providers managing record sets, which require txt values to be quoted
+// and hostnames to be fully qualified with a trailing dot.
+func rrsetValue(typ, answer string) string {
+	switch {
+	case typ == "TXT":
+		return strconv.Quote(answer)
+	case hostnameType(typ) && !strings.HasSuffix(answer, "."):
+		return answer + "."
+	}
+	return answer
+}
+
+// rrsetAnswer returns the answer of the given value of a resource record.
+func rrsetAnswer(typ, value string) string {
+	if hostnameType(typ) {
+		return NormalizeAnswer(typ, value)
+	}
+	if typ != "TXT" {
+		return value
+	}
+	if s, err := strconv.Unquote(value); err == nil {
+		return s
+	}
+	return value
+}
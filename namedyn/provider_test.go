@@ -0,0 +1,256 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeProvider keeps the records in memory and records the changes made to them.
+type fakeProvider struct {
+	mu      sync.Mutex
+	records []*Record
+	nextID  int
+	// errs contains the errors returned by the operations find, create, update and delete.
+	errs map[string]error
+	// calls contains the changes in order, e.g. "create home A 203.0.113.1".
+	calls []string
+	// finds is the number of times the records have been looked up.
+	finds int
+}
+
+func (p *fakeProvider) call(op string, rec *Record) error {
+	p.calls = append(p.calls, fmt.Sprintf("%s %s %s %s", op, rec.Host, rec.Type, rec.Answer))
+	return p.errs[op]
+}
+
+func (p *fakeProvider) FindRecords(_ context.Context, host, typ string) ([]*Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finds++
+	if err := p.errs["find"]; err != nil {
+		return nil, err
+	}
+	var records []*Record
+	for _, r := range p.records {
+		if strings.EqualFold(r.Host, host) && r.Type == typ {
+			c := *r
+			// like most providers, the options of the records are not reported
+			c.Options = nil
+			records = append(records, &c)
+		}
+	}
+	return records, nil
+}
+
+func (p *fakeProvider) CreateRecord(_ context.Context, rec *Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("create", rec); err != nil {
+		return err
+	}
+	p.nextID++
+	rec.ID = strconv.Itoa(p.nextID)
+	c := *rec
+	p.records = append(p.records, &c)
+	return nil
+}
+
+func (p *fakeProvider) UpdateRecord(_ context.Context, rec *Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("update", rec); err != nil {
+		return err
+	}
+	for i, r := range p.records {
+		if r.ID == rec.ID {
+			c := *rec
+			p.records[i] = &c
+			return nil
+		}
+	}
+	return fmt.Errorf("record %s does not exist", rec.ID)
+}
+
+func (p *fakeProvider) DeleteRecord(_ context.Context, rec *Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("delete", rec); err != nil {
+		return err
+	}
+	for i, r := range p.records {
+		if r.ID == rec.ID {
+			p.records = append(p.records[:i], p.records[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("record %s does not exist", rec.ID)
+}
+
+// apiServer is a mock of the api of a provider. It records the requests, checks
+// their credentials and passes them on to the handler of the provider.
+type apiServer struct {
+	mu sync.Mutex
+	// auth checks the credentials of a request and replies to it if they are invalid.
+	auth func(w http.ResponseWriter, r *http.Request, body []byte) bool
+	// handle replies to the requests with valid credentials.
+	handle func(w http.ResponseWriter, r *http.Request, body []byte)
+	// status contains the status codes replied to the methods instead of handling the requests.
+	status map[string]int
+	// failed is the body replied together with the status codes.
+	failed string
+	// requests contains the requests in order, e.g. "PUT /v2/domains/example.com/records/1 {...}".
+	requests []string
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+strings.TrimSpace(string(b))))
+	if !s.auth(w, r, b) {
+		return
+	}
+	if status, ok := s.status[r.Method]; ok {
+		w.WriteHeader(status)
+		w.Write([]byte(s.failed))
+		return
+	}
+	s.handle(w, r, b)
+}
+
+// fail lets the mock reply the given status code to the requests using the given method.
+func (s *apiServer) fail(method string, status int) *apiServer {
+	if s.status == nil {
+		s.status = map[string]int{}
+	}
+	s.status[method] = status
+	return s
+}
+
+// start starts the mock until the end of the test.
+func (s *apiServer) start(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// headerAuth returns a credentials check accepting the requests with the given
+// header value, the others are rejected with status code 401 and the given body.
+func headerAuth(key, value, denied string) func(http.ResponseWriter, *http.Request, []byte) bool {
+	return func(w http.ResponseWriter, r *http.Request, _ []byte) bool {
+		if r.Header.Get(key) == value {
+			return true
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(denied))
+		return false
+	}
+}
+
+func TestSuccessful(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{status: http.StatusOK, want: true},
+		{status: http.StatusCreated, want: true},
+		{status: http.StatusAccepted, want: true},
+		{status: http.StatusNoContent, want: true},
+		{status: http.StatusMultipleChoices},
+		{status: http.StatusBadRequest},
+		{status: http.StatusUnauthorized},
+		{status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			if got := successful(&http.Response{StatusCode: tt.status}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		status       int
+		err          bool
+		unauthorized bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusCreated},
+		{status: http.StatusAccepted},
+		{status: http.StatusNoContent},
+		{status: http.StatusMultipleChoices, err: true},
+		{status: http.StatusBadRequest, err: true},
+		{status: http.StatusUnauthorized, err: true, unauthorized: true},
+		{status: http.StatusForbidden, err: true, unauthorized: true},
+		{status: http.StatusInternalServerError, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.status, Body: ioutil.NopCloser(strings.NewReader("reason"))}
+			err := checkResponse(res)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if errors.Is(err, ErrUnauthorized) != tt.unauthorized {
+				t.Errorf("got error %v, want unauthorized %v", err, tt.unauthorized)
+			}
+			if err != nil && !strings.Contains(err.Error(), "reason") {
+				t.Errorf("got error %v, want it to contain the body", err)
+			}
+		})
+	}
+}
+
+func TestRRSetValue(t *testing.T) {
+	tests := []struct {
+		typ    string
+		answer string
+		value  string
+	}{
+		{typ: "A", answer: "203.0.113.1", value: "203.0.113.1"},
+		{typ: "TXT", answer: `a "b"`, value: `"a \"b\""`},
+		{typ: "CNAME", answer: "target.example.net", value: "target.example.net."},
+		{typ: "MX", answer: "mail.example.net", value: "mail.example.net."},
+		{typ: "SRV", answer: "sip.example.net", value: "sip.example.net."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			if got := rrsetValue(tt.typ, tt.answer); got != tt.value {
+				t.Errorf("got value %q, want %q", got, tt.value)
+			}
+			if got := rrsetAnswer(tt.typ, tt.value); got != tt.answer {
+				t.Errorf("got answer %q, want %q", got, tt.answer)
+			}
+		})
+	}
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		typ    string
+		answer string
+		want   string
+	}{
+		{typ: "CNAME", answer: "Target.Example.net.", want: "target.example.net"},
+		{typ: "CNAME", answer: "target.example.net", want: "target.example.net"},
+		{typ: "MX", answer: "mail.example.net.", want: "mail.example.net"},
+		{typ: "SRV", answer: "SIP.example.net.", want: "sip.example.net"},
+		{typ: "TXT", answer: "Value.", want: "Value."},
+		{typ: "AAAA", answer: "2001:DB8::1", want: "2001:DB8::1"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAnswer(tt.typ, tt.answer); got != tt.want {
+			t.Errorf("got %q for %s %q, want %q", got, tt.typ, tt.answer, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package namedyn
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Refresher triggers immediate cycles requested by http, e.g. by a
+// webhook of the router, instead of waiting for the next interval.
+type Refresher struct {
+	// token is the shared secret authorizing the requests.
+	token string
+	// requests passes a channel to the main loop for every requested
+	// cycle, which receives whether the cycle was successful.
+	requests chan chan bool
+}
+
+// NewRefresher returns a refresher authorizing the requests by the given
+// token, which must not be blank, as the requests would not be authorized
+// at all otherwise.
+func NewRefresher(token string) (*Refresher, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, errors.New("the token must not be blank")
+	}
+	return &Refresher{token: token, requests: make(chan chan bool)}, nil
+}
+
+// Requests returns the channel receiving a channel for every requested
+// cycle, which needs to receive whether the cycle was successful.
+func (r *Refresher) Requests() <-chan chan bool {
+	return r.requests
+}
+
+// ServeHTTP implements http.Handler, it runs a cycle for authorized post
+// requests and returns 200 if it was successful and 500 otherwise.
+func (r *Refresher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(r.token) == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+r.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	result := make(chan bool, 1)
+	// the cycle is run by the main loop, so it never overlaps with a scheduled one
+	select {
+	case r.requests <- result:
+	case <-req.Context().Done():
+		return
+	}
+	logger.Info("refresh requested", "remote", req.RemoteAddr)
+	select {
+	case ok := <-result:
+		if !ok {
+			http.Error(w, "the cycle failed", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok, the cycle was successful")
+	case <-req.Context().Done():
+	}
+}
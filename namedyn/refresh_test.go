@@ -0,0 +1,74 @@
+package namedyn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRefresherBlankToken(t *testing.T) {
+	for _, token := range []string{"", " ", "\t\n"} {
+		if _, err := NewRefresher(token); err == nil {
+			t.Errorf("got no error for token %q", token)
+		}
+	}
+}
+
+func TestRefresherServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		// ok is the outcome of the requested cycle, if one is run.
+		ok   bool
+		want int
+	}{
+		{name: "get", method: http.MethodGet, auth: "Bearer secret", want: http.StatusMethodNotAllowed},
+		{name: "no header", method: http.MethodPost, want: http.StatusUnauthorized},
+		{name: "blank token", method: http.MethodPost, auth: "Bearer ", want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, auth: "Bearer other", want: http.StatusUnauthorized},
+		{name: "missing scheme", method: http.MethodPost, auth: "secret", want: http.StatusUnauthorized},
+		{name: "successful cycle", method: http.MethodPost, auth: "Bearer secret", ok: true, want: http.StatusOK},
+		{name: "failed cycle", method: http.MethodPost, auth: "Bearer secret", ok: false, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRefresher("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cycles := make(chan struct{}, 1)
+			go func() {
+				for result := range r.Requests() {
+					cycles <- struct{}{}
+					result <- tt.ok
+				}
+			}()
+			req := httptest.NewRequest(tt.method, "/refresh", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %v, want %v: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			ran := len(cycles) == 1
+			if wantRun := tt.want == http.StatusOK || tt.want == http.StatusInternalServerError; ran != wantRun {
+				t.Errorf("cycle run %v, want %v", ran, wantRun)
+			}
+		})
+	}
+}
+
+func TestRefresherWithoutToken(t *testing.T) {
+	// a refresher not created by NewRefresher must not accept blank tokens either
+	r := &Refresher{requests: make(chan chan bool)}
+	req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
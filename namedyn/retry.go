@@ -0,0 +1,232 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryTransport retries requests failing with network errors or 5xx status
+// codes using exponential backoff with jitter. Requests which are not
+// idempotent, e.g. creating records using POST without an Idempotency-Key
+// header, are only retried if they have not been sent, as they could be
+// applied twice otherwise. A DELETE request failing with 404 after a previous
+// attempt may have been applied is considered successful. Rate limited
+// requests are retried after the duration requested by the server, which is
+// remembered per host, so later requests to the host wait for it as well even
+// if they are not retried. Other client errors and requests whose body can not
+// be sent again are not retried.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	// Delay is the base delay, which gets doubled with every retry.
+	Delay time.Duration
+
+	mu sync.Mutex
+	// limited contains the time until which the requests to a host are
+	// delayed because of its Retry-After header.
+	limited map[string]time.Time
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// applied is set if a previous attempt may have been applied by the server
+	var applied bool
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			// the body of the previous attempt has been consumed
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+		res, err := t.Base.RoundTrip(r)
+		if err == nil && applied && req.Method == http.MethodDelete && res.StatusCode == http.StatusNotFound {
+			ctxLogger(req.Context()).Debug("deleted by a previous attempt", "host", req.URL.Host, "attempt", attempt+1)
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			res.StatusCode = http.StatusNoContent
+			res.Status = "204 No Content"
+			res.ContentLength = 0
+			res.Body = http.NoBody
+			return res, nil
+		}
+		d := backoff(t.Delay, attempt)
+		rateLimited := res != nil && res.StatusCode == http.StatusTooManyRequests
+		if rateLimited {
+			if after, ok := retryAfter(res); ok {
+				d = after
+				t.limit(req.URL.Host, after)
+			}
+		}
+		if attempt >= t.MaxRetries || !retryable(req, res, err) {
+			return res, err
+		}
+		// the outcome of the last attempt is returned instead of waiting
+		// if the deadline of the request would expire before the retry
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(d).After(deadline) {
+			return res, err
+		}
+		if (err != nil && sent(err)) || (err == nil && res.StatusCode >= 500) {
+			applied = true
+		}
+		if res != nil {
+			// drain the body to allow reusing the connection
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if rateLimited {
+			ctxLogger(req.Context()).Warn("rate limited, retrying request", "host", req.URL.Host, "attempt", attempt+1, "delay", d)
+		} else {
+			ctxLogger(req.Context()).Warn("retrying request", "host", req.URL.Host, "attempt", attempt+1, "delay", d, "error", retryReason(res, err))
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// limit delays the requests to the given host for the given duration.
+func (t *RetryTransport) limit(host string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limited == nil {
+		t.limited = make(map[string]time.Time)
+	}
+	t.limited[host] = time.Now().Add(d)
+}
+
+// wait waits until the host of the given request is no longer rate limited.
+// An error is returned instead if the deadline of the request would expire
+// before.
+func (t *RetryTransport) wait(req *http.Request) error {
+	t.mu.Lock()
+	until, ok := t.limited[req.URL.Host]
+	if ok && !time.Now().Before(until) {
+		delete(t.limited, req.URL.Host)
+		ok = false
+	}
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if deadline, ok := req.Context().Deadline(); ok && until.After(deadline) {
+		return fmt.Errorf("rate limited by %s until %s", req.URL.Host, until.Format(time.RFC3339))
+	}
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-time.After(time.Until(until)):
+		return nil
+	}
+}
+
+// retryable returns true if the request failed with a network error or a
+// 5xx status code or has been rate limited and can be sent again. Requests
+// which are not idempotent are only retried if they have not been sent or
+// have been rejected because of the rate limit.
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	// the body can not be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if !idempotent(req) {
+		return err != nil && !sent(err)
+	}
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= 500
+}
+
+// idempotentKey is the context key marking requests as idempotent.
+type idempotentKey struct{}
+
+// withIdempotent returns a copy of ctx marking the requests sent using it as
+// idempotent, so they are retried regardless of their method, e.g. lookups
+// which are posted.
+func withIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// idempotent returns true if sending the given request multiple times has the
+// same effect as sending it once, which is the case for its method, if its
+// context has been marked using withIdempotent or if it has an idempotency key
+// like for http.Transport.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if ok, _ := req.Context().Value(idempotentKey{}).(bool); ok {
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// sent returns false if the given error occurred before the request has been
+// sent, i.e. while connecting to the server, and true if it may have been.
+func sent(err error) bool {
+	var opErr *net.OpError
+	return !errors.As(err, &opErr) || opErr.Op != "dial"
+}
+
+// retryAfter returns the duration of the Retry-After header,
+// which is either given in seconds or as http date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	h := res.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryReason returns a description of why the request failed.
+func retryReason(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return res.Status
+}
+
+// backoff returns the delay before the given retry attempt,
+// which is doubled for every attempt and randomized by up to 50%.
+func backoff(delay time.Duration, attempt int) time.Duration {
+	d := delay << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,259 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reply is the outcome of a single attempt of a request.
+type reply struct {
+	status int
+	header http.Header
+	err    error
+}
+
+// stubTransport replies to the attempts in order and records their bodies.
+type stubTransport struct {
+	replies []reply
+	bodies  []string
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body string
+	if req.Body != nil {
+		b, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		body = string(b)
+	}
+	s.bodies = append(s.bodies, body)
+	r := s.replies[len(s.bodies)-1]
+	if r.err != nil {
+		return nil, r.err
+	}
+	header := r.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: r.status,
+		Status:     http.StatusText(r.status),
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+var (
+	errDial  = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	errReset = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		// idempotent marks the request using withIdempotent.
+		idempotent bool
+		body       string
+		replies    []reply
+		// attempts is the expected number of attempts.
+		attempts int
+		status   int
+		err      bool
+	}{
+		{name: "success", method: http.MethodGet, replies: []reply{{status: 200}}, attempts: 1, status: 200},
+		{name: "get after 5xx", method: http.MethodGet, replies: []reply{{status: 502}, {status: 503}, {status: 200}}, attempts: 3, status: 200},
+		{name: "get after network error", method: http.MethodGet, replies: []reply{{err: errReset}, {status: 200}}, attempts: 2, status: 200},
+		{name: "put after 5xx", method: http.MethodPut, body: "x", replies: []reply{{status: 500}, {status: 200}}, attempts: 2, status: 200},
+		{name: "delete after 5xx", method: http.MethodDelete, replies: []reply{{status: 500}, {status: 204}}, attempts: 2, status: 204},
+		{name: "client error", method: http.MethodGet, replies: []reply{{status: 404}}, attempts: 1, status: 404},
+		{name: "max retries", method: http.MethodGet, replies: []reply{{status: 500}, {status: 500}, {status: 500}, {status: 500}}, attempts: 4, status: 500},
+		{name: "post after 5xx", method: http.MethodPost, body: "x", replies: []reply{{status: 500}}, attempts: 1, status: 500},
+		{name: "post after error while sending", method: http.MethodPost, body: "x", replies: []reply{{err: errReset}}, attempts: 1, err: true},
+		{name: "post after dial error", method: http.MethodPost, body: "x", replies: []reply{{err: errDial}, {status: 201}}, attempts: 2, status: 201},
+		{name: "post after rate limit", method: http.MethodPost, body: "x", replies: []reply{{status: 429}, {status: 201}}, attempts: 2, status: 201},
+		{name: "post with idempotency key after 5xx", method: http.MethodPost, header: http.Header{"Idempotency-Key": nil}, body: "x", replies: []reply{{status: 500}, {status: 201}}, attempts: 2, status: 201},
+		{name: "delete after applied 5xx", method: http.MethodDelete, replies: []reply{{status: 500}, {status: 404}}, attempts: 2, status: 204},
+		{name: "delete after rate limit", method: http.MethodDelete, replies: []reply{{status: 429, header: http.Header{"Retry-After": {"0"}}}, {status: 404}}, attempts: 2, status: 404},
+		{name: "delete after dial error", method: http.MethodDelete, replies: []reply{{err: errDial}, {status: 404}}, attempts: 2, status: 404},
+		{name: "delete missing", method: http.MethodDelete, replies: []reply{{status: 404}}, attempts: 1, status: 404},
+		{name: "post marked as idempotent after 5xx", method: http.MethodPost, idempotent: true, body: "x", replies: []reply{{status: 500}, {status: 200}}, attempts: 2, status: 200},
+		{name: "post marked as idempotent after error while sending", method: http.MethodPost, idempotent: true, body: "x", replies: []reply{{err: errReset}, {status: 200}}, attempts: 2, status: 200},
+		{name: "patch after 5xx", method: http.MethodPatch, body: "x", replies: []reply{{status: 500}}, attempts: 1, status: 500},
+		{name: "rate limit with retry-after", method: http.MethodGet, replies: []reply{{status: 429, header: http.Header{"Retry-After": {"0"}}}, {status: 200}}, attempts: 2, status: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubTransport{replies: tt.replies}
+			tr := &RetryTransport{Base: stub, MaxRetries: 3}
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, "https://api.example.com/records", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			if tt.idempotent {
+				req = req.WithContext(withIdempotent(req.Context()))
+			}
+			res, err := tr.RoundTrip(req)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if err == nil && res.StatusCode != tt.status {
+				t.Errorf("got status %v, want %v", res.StatusCode, tt.status)
+			}
+			if len(stub.bodies) != tt.attempts {
+				t.Errorf("got %v attempts, want %v", len(stub.bodies), tt.attempts)
+			}
+			// every attempt needs to send the complete body
+			for i, b := range stub.bodies {
+				if b != tt.body {
+					t.Errorf("attempt %v sent body %q, want %q", i+1, b, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportWithoutGetBody(t *testing.T) {
+	stub := &stubTransport{replies: []reply{{status: 500}, {status: 200}}}
+	tr := &RetryTransport{Base: stub, MaxRetries: 3}
+	req, err := http.NewRequest(http.MethodPut, "https://api.example.com/records/1", ioutil.NopCloser(strings.NewReader("x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.GetBody != nil {
+		t.Fatal("the request is expected to have no GetBody")
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the consumed body can not be sent again, so the reply of the first attempt is returned
+	if res.StatusCode != 500 || len(stub.bodies) != 1 {
+		t.Errorf("got status %v after %v attempts, want 500 after 1", res.StatusCode, len(stub.bodies))
+	}
+}
+
+func TestRetryTransportRemembersRetryAfter(t *testing.T) {
+	stub := &stubTransport{replies: []reply{{status: 429, header: http.Header{"Retry-After": {"60"}}}, {status: 200}}}
+	tr := &RetryTransport{Base: stub, MaxRetries: 0}
+	req, err := http.NewRequest(http.MethodGet, "https://api.example.com/records", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 429 {
+		t.Fatalf("got status %v, want 429 without retries", res.StatusCode)
+	}
+	// the next request to the host would have to wait a minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tr.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Error("expected an error while the host is rate limited")
+	}
+	if len(stub.bodies) != 1 {
+		t.Errorf("got %v attempts, want the rate limited host not to be requested again", len(stub.bodies))
+	}
+	// other hosts are not affected
+	other, err := http.NewRequest(http.MethodGet, "https://other.example.com/records", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = tr.RoundTrip(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("got status %v, want 200", res.StatusCode)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{header: "", ok: false},
+		{header: "5", want: 5 * time.Second, ok: true},
+		{header: "-1", ok: false},
+		{header: "soon", ok: false},
+		{header: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), want: 0, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				res.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(res)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 4; attempt++ {
+		d := time.Second << uint(attempt)
+		for i := 0; i < 20; i++ {
+			if got := backoff(time.Second, attempt); got < d/2 || got > d {
+				t.Errorf("attempt %v: got %v, want between %v and %v", attempt, got, d/2, d)
+			}
+		}
+	}
+	if got := backoff(0, 3); got != 0 {
+		t.Errorf("got %v, want 0 without delay", got)
+	}
+}
+
+// countingTransport counts the attempts sent using base.
+type countingTransport struct {
+	base     http.RoundTripper
+	attempts int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.attempts++
+	return c.base.RoundTrip(req)
+}
+
+func TestRetryTransportConnectionRefused(t *testing.T) {
+	// the port is closed again, so connecting to it is refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	c := &countingTransport{base: &http.Transport{}}
+	tr := &RetryTransport{Base: c, MaxRetries: 2}
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/records", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("expected an error")
+	}
+	// the request has not been sent, so it is safe to retry it
+	if c.attempts != 3 {
+		t.Errorf("got %v attempts, want 3", c.attempts)
+	}
+}
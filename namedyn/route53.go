@@ -0,0 +1,197 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Route53Provider manages the records of a hosted zone using the route 53 api.
+type Route53Provider struct {
+	cli    Doer
+	client *route53.Client
+	zoneID string
+	domain string
+}
+
+// NewRoute53Provider returns a provider managing the records of the given
+// domain in the hosted zone with the given id using the route 53 api at baseURL,
+// e.g. https://route53.amazonaws.com. The requests are signed using the given
+// credentials or, if they are empty, the credentials found by the default
+// credential chain of the aws sdk.
+func NewRoute53Provider(cli Doer, baseURL, zoneID, domain string, static AWSCredentials) *Route53Provider {
+	client := route53.New(route53.Options{
+		// route 53 is a global service which is signed for us-east-1
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(strings.TrimSuffix(baseURL, "/")),
+		Credentials:  &awsCredentialSource{cli: cli, static: static},
+		HTTPClient:   cli,
+		// the requests are retried by the client if it is configured to
+		Retryer: aws.NopRetryer{},
+	})
+	return &Route53Provider{
+		cli:    cli,
+		client: client,
+		zoneID: strings.TrimPrefix(zoneID, "/hostedzone/"),
+		domain: domain,
+	}
+}
+
+// timedDoer sends the requests of the aws sdk using timedDo.
+type timedDoer struct {
+	cli       Doer
+	operation string
+}
+
+// Do implements Doer.
+func (d timedDoer) Do(req *http.Request) (*http.Response, error) {
+	return timedDo(d.cli, d.operation, req)
+}
+
+// timed returns an option of a route 53 api call measuring the duration
+// of its requests as the given operation, which is used by the metrics.
+func (p *Route53Provider) timed(operation string) func(*route53.Options) {
+	return func(o *route53.Options) {
+		o.HTTPClient = timedDoer{cli: p.cli, operation: operation}
+	}
+}
+
+// route53Error returns the given error of the route 53 api, which
+// wraps ErrUnauthorized if the credentials have been rejected.
+func route53Error(err error) error {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) && (re.HTTPStatusCode() == http.StatusUnauthorized || re.HTTPStatusCode() == http.StatusForbidden) {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+	return err
+}
+
+// FindRecords searches for the host records of the given type. Route 53 manages
+// all values of a record as one resource record set, so a record is returned
+// for every value, which is also used as its id.
+func (p *Route53Provider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	rs, err := p.recordSet(ctx, host, typ)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing dns records using route 53 api: %w", err)
+	}
+	if rs == nil {
+		return nil, nil
+	}
+	var records []*Record
+	for _, rr := range rs.ResourceRecords {
+		value := aws.ToString(rr.Value)
+		records = append(records, &Record{
+			ID:     value,
+			Host:   host,
+			Type:   typ,
+			Answer: rrsetAnswer(typ, value),
+			TTL:    int32(aws.ToInt64(rs.TTL)),
+		})
+	}
+	return records, nil
+}
+
+// recordSet returns the resource record set of the given host and type or nil if it does not exist.
+func (p *Route53Provider) recordSet(ctx context.Context, host, typ string) (*types.ResourceRecordSet, error) {
+	name := p.name(host)
+	out, err := p.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(p.zoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: types.RRType(typ),
+		MaxItems:        aws.Int32(1),
+	}, p.timed("list"))
+	if err != nil {
+		return nil, route53Error(err)
+	}
+	// the record sets are listed starting at the given name,
+	// so the first one belongs to another record if there is none
+	for i, rs := range out.ResourceRecordSets {
+		if strings.EqualFold(unescapeRoute53Name(aws.ToString(rs.Name)), name) && string(rs.Type) == typ && len(rs.ResourceRecords) > 0 {
+			return &out.ResourceRecordSets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateRecord creates the given record.
+func (p *Route53Provider) CreateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "create", rec, "", rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while creating dns record using route 53 api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *Route53Provider) UpdateRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "update", rec, rec.ID, rrsetValue(rec.Type, rec.Answer)); err != nil {
+		return fmt.Errorf("error while updating dns record using route 53 api: %s", err)
+	}
+	rec.ID = rrsetValue(rec.Type, rec.Answer)
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *Route53Provider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.change(ctx, "delete", rec, rec.ID, ""); err != nil {
+		return fmt.Errorf("error while deleting dns record using route 53 api: %s", err)
+	}
+	return nil
+}
+
+// change removes the value remove from the resource record set of the given
+// record and adds the value add, both are ignored if they are empty. The ttl of
+// the record is applied to the whole set, which is deleted if it ends up empty.
+// The operation is used by the metrics.
+func (p *Route53Provider) change(ctx context.Context, operation string, rec *Record, remove, add string) error {
+	current, err := p.recordSet(ctx, rec.Host, rec.Type)
+	if err != nil {
+		return err
+	}
+	rs := types.ResourceRecordSet{Name: aws.String(p.name(rec.Host)), Type: types.RRType(rec.Type), TTL: aws.Int64(int64(rec.TTL))}
+	if current != nil {
+		for _, rr := range current.ResourceRecords {
+			if v := aws.ToString(rr.Value); v != remove && v != add {
+				rs.ResourceRecords = append(rs.ResourceRecords, rr)
+			}
+		}
+	}
+	if add != "" {
+		rs.ResourceRecords = append(rs.ResourceRecords, types.ResourceRecord{Value: aws.String(add)})
+	}
+	c := types.Change{Action: types.ChangeActionUpsert, ResourceRecordSet: &rs}
+	if len(rs.ResourceRecords) == 0 {
+		if current == nil {
+			return nil
+		}
+		// deleting a set requires its current values
+		c = types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: current}
+	}
+	_, err = p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(p.zoneID),
+		ChangeBatch:  &types.ChangeBatch{Changes: []types.Change{c}},
+	}, p.timed(operation))
+	return route53Error(err)
+}
+
+// name returns the fully qualified name of the given host with
+// a trailing dot, as used by the route 53 api.
+func (p *Route53Provider) name(host string) string {
+	if host == "" {
+		return p.domain + "."
+	}
+	return fmt.Sprintf("%s.%s.", host, p.domain)
+}
+
+// unescapeRoute53Name replaces the octal escape of the asterisk
+// returned by the route 53 api for wildcard records.
+func unescapeRoute53Name(name string) string {
+	return strings.ReplaceAll(name, `\052`, "*")
+}
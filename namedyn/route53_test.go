@@ -0,0 +1,194 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// route53Change is a change sent to the route 53 mock, its values are joined by commas.
+type route53Change struct {
+	Action string `xml:"Action"`
+	Name   string `xml:"ResourceRecordSet>Name"`
+	Type   string `xml:"ResourceRecordSet>Type"`
+	TTL    int32  `xml:"ResourceRecordSet>TTL"`
+	Values string `xml:"-"`
+}
+
+// route53Server is a mock of the route 53 api managing the values of the
+// record set home.example.com of type A, the set is missing if values is empty.
+type route53Server struct {
+	values  []string
+	changes []route53Change
+	status  int
+}
+
+func (s *route53Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+		q := r.URL.Query()
+		if q.Get("name") != "home.example.com." || q.Get("type") != "A" || q.Get("maxitems") != "1" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		// the following record set is listed if the requested one is missing
+		set := `<ResourceRecordSet><Name>\052.example.com.</Name><Type>A</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>198.51.100.1</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>`
+		if len(s.values) > 0 {
+			set = `<ResourceRecordSet><Name>home.example.com.</Name><Type>A</Type><TTL>300</TTL><ResourceRecords>`
+			for _, v := range s.values {
+				set += `<ResourceRecord><Value>` + v + `</Value></ResourceRecord>`
+			}
+			set += `</ResourceRecords></ResourceRecordSet>`
+		}
+		fmt.Fprintf(w, `<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ResourceRecordSets>%s</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListResourceRecordSetsResponse>`, set)
+	case r.Method == http.MethodPost && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+		var req struct {
+			Changes []struct {
+				route53Change
+				Values []string `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, c := range req.Changes {
+			c.route53Change.Values = strings.Join(c.Values, ",")
+			s.changes = append(s.changes, c.route53Change)
+		}
+		w.Write([]byte(`<ChangeResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2020-07-14T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// newRoute53Provider returns a provider using the given mock with static credentials.
+func newRoute53Provider(t *testing.T, s *route53Server) *Route53Provider {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return NewRoute53Provider(srv.Client(), srv.URL, "/hostedzone/Z1", "example.com", AWSCredentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+}
+
+func TestRoute53FindRecords(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []*Record
+	}{
+		{
+			name: "missing",
+		},
+		{
+			name:   "values",
+			values: []string{"203.0.113.1", "203.0.113.2"},
+			want: []*Record{
+				{ID: "203.0.113.1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+				{ID: "203.0.113.2", Host: "home", Type: "A", Answer: "203.0.113.2", TTL: 300},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRoute53Provider(t, &route53Server{values: tt.values})
+			got, err := p.FindRecords(context.Background(), "home", "A")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoute53Changes(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		change func(p *Route53Provider, rec *Record) error
+		want   []route53Change
+	}{
+		{
+			name: "create",
+			change: func(p *Route53Provider, rec *Record) error {
+				return p.CreateRecord(context.Background(), rec)
+			},
+			want: []route53Change{{Action: "UPSERT", Name: "home.example.com.", Type: "A", TTL: 60, Values: "203.0.113.9"}},
+		},
+		{
+			name:   "create keeps the other values",
+			values: []string{"203.0.113.1"},
+			change: func(p *Route53Provider, rec *Record) error {
+				return p.CreateRecord(context.Background(), rec)
+			},
+			want: []route53Change{{Action: "UPSERT", Name: "home.example.com.", Type: "A", TTL: 60, Values: "203.0.113.1,203.0.113.9"}},
+		},
+		{
+			name:   "update",
+			values: []string{"203.0.113.1", "203.0.113.2"},
+			change: func(p *Route53Provider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.UpdateRecord(context.Background(), rec)
+			},
+			want: []route53Change{{Action: "UPSERT", Name: "home.example.com.", Type: "A", TTL: 60, Values: "203.0.113.2,203.0.113.9"}},
+		},
+		{
+			name:   "delete a value",
+			values: []string{"203.0.113.1", "203.0.113.2"},
+			change: func(p *Route53Provider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+			want: []route53Change{{Action: "UPSERT", Name: "home.example.com.", Type: "A", TTL: 60, Values: "203.0.113.2"}},
+		},
+		{
+			name:   "delete the last value",
+			values: []string{"203.0.113.1"},
+			change: func(p *Route53Provider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+			// deleting a set requires its current ttl and values
+			want: []route53Change{{Action: "DELETE", Name: "home.example.com.", Type: "A", TTL: 300, Values: "203.0.113.1"}},
+		},
+		{
+			name: "delete a missing record",
+			change: func(p *Route53Provider, rec *Record) error {
+				rec.ID = "203.0.113.1"
+				return p.DeleteRecord(context.Background(), rec)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &route53Server{values: tt.values}
+			p := newRoute53Provider(t, s)
+			rec := &Record{Host: "home", Type: "A", Answer: "203.0.113.9", TTL: 60}
+			if err := tt.change(p, rec); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(s.changes, tt.want) {
+				t.Errorf("got changes %+v, want %+v", s.changes, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoute53Unauthorized(t *testing.T) {
+	p := newRoute53Provider(t, &route53Server{status: http.StatusForbidden})
+	_, err := p.FindRecords(context.Background(), "home", "A")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got error %v, want it to wrap %v", err, ErrUnauthorized)
+	}
+}
@@ -0,0 +1,66 @@
+package namedyn
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Secret provides a credential, which may change while running.
+type Secret interface {
+	Value() string
+}
+
+// StaticSecret is a credential which never changes.
+type StaticSecret string
+
+// Value returns the credential.
+func (s StaticSecret) Value() string {
+	return string(s)
+}
+
+// FileSecret is a credential read from a file whenever it is used, so
+// credentials rotated by a secrets manager take effect without a restart.
+type FileSecret struct {
+	path string
+	mu   sync.Mutex
+	// last is the most recent value read from the file.
+	last   string
+	failed bool
+}
+
+// NewFileSecret returns a secret read from the file at path, initial is the
+// value read at startup, which is used as long as the file can not be read.
+func NewFileSecret(path, initial string) *FileSecret {
+	return &FileSecret{path: path, last: initial}
+}
+
+// Value reads the credential from the file. If reading fails or the file is
+// blank, e.g. while it is being rewritten, a warning is logged once and the
+// last value read is returned.
+func (s *FileSecret) Value() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := ioutil.ReadFile(s.path)
+	v := strings.TrimRight(string(b), " \t\r\n")
+	if err == nil && strings.TrimSpace(v) == "" {
+		err = errors.New("the file is blank")
+	}
+	if err != nil {
+		if !s.failed {
+			logger.Warn("could not read credential file, using the last value read", "path", s.path, "error", err)
+			s.failed = true
+		}
+		return s.last
+	}
+	if s.failed {
+		logger.Info("credential file can be read again", "path", s.path)
+		s.failed = false
+	}
+	if v != s.last {
+		logger.Info("credential file changed, using the new value", "path", s.path)
+		s.last = v
+	}
+	return s.last
+}
@@ -0,0 +1,64 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SlackNotifier posts changes and alerts to a slack incoming webhook.
+type SlackNotifier struct {
+	cli Doer
+	url string
+}
+
+// NewSlackNotifier returns a notifier posting to the given slack incoming webhook url.
+func NewSlackNotifier(cli Doer, url string) *SlackNotifier {
+	return &SlackNotifier{
+		cli: cli,
+		url: url,
+	}
+}
+
+// Notify posts the given change to slack.
+func (n *SlackNotifier) Notify(ctx context.Context, c Change) error {
+	text := fmt.Sprintf(":white_check_mark: created `%s` %s record with ip `%s`", c.Host, c.Type, c.NewIP)
+	if c.OldIP != "" {
+		text = fmt.Sprintf(":arrows_counterclockwise: `%s` %s record changed from `%s` → `%s`", c.Host, c.Type, c.OldIP, c.NewIP)
+	}
+	if c.NewIP == "" {
+		text = fmt.Sprintf(":wastebasket: deleted `%s` %s record with ip `%s`", c.Host, c.Type, c.OldIP)
+	}
+	return n.post(ctx, text)
+}
+
+// Alert posts the given alert to slack.
+func (n *SlackNotifier) Alert(ctx context.Context, a Alert) error {
+	return n.post(ctx, fmt.Sprintf(":warning: %s", a))
+}
+
+// post posts the given text to slack.
+func (n *SlackNotifier) post(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("error while creating slack request body: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error while creating slack request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := timedDo(n.cli, "notify", req)
+	if err != nil {
+		// the error contains the url, which is a secret
+		return fmt.Errorf("error while posting to slack: %s", redact(err.Error(), n.url))
+	}
+	defer res.Body.Close()
+	if !successful(res) {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("unexpected status code %v while posting to slack: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
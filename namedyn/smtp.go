@@ -0,0 +1,110 @@
+package namedyn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier sends changes and alerts by email.
+type SMTPNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPNotifier returns a notifier sending emails from the given address to
+// the given recipients using the smtp server at host and port. The connection
+// is upgraded using STARTTLS if supported by the server, port 465 uses implicit
+// tls instead. The credentials are only used if username is not empty.
+func NewSMTPNotifier(host string, port int, username, password, from string, to []string) *SMTPNotifier {
+	return &SMTPNotifier{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+// Notify sends the given change by email.
+func (n *SMTPNotifier) Notify(ctx context.Context, c Change) error {
+	return n.send(ctx, "namedyn: "+c.String(), fmt.Sprintf("%s at %s.\n", c, c.Time.Format(time.RFC1123Z)))
+}
+
+// Alert sends the given alert by email.
+func (n *SMTPNotifier) Alert(ctx context.Context, a Alert) error {
+	return n.send(ctx, "namedyn: "+a.String(), fmt.Sprintf("%s, last failure at %s.\n", a, a.Time.Format(time.RFC1123Z)))
+}
+
+// send sends an email with the given subject and body to all recipients.
+func (n *SMTPNotifier) send(ctx context.Context, subject, body string) error {
+	start := time.Now()
+	defer func() { requestDuration.observe(time.Since(start).Seconds(), "notify") }()
+	addr := net.JoinHostPort(n.host, strconv.Itoa(n.port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error while connecting to smtp server %s: %s", addr, err)
+	}
+	// the smtp client does not support contexts
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if n.port == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: n.host})
+	}
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error while connecting to smtp server %s: %s", addr, err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && n.port != 465 {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return fmt.Errorf("error while starting tls with smtp server %s: %s", addr, err)
+		}
+	}
+	if n.username != "" {
+		// plain auth refuses to send the credentials over unencrypted connections
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return fmt.Errorf("error while authenticating with smtp server %s: %s", addr, err)
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return fmt.Errorf("error while sending email from %s: %s", n.from, err)
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("error while sending email to %s: %s", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error while sending email: %s", err)
+	}
+	headers := []string{
+		"From: " + n.from,
+		"To: " + strings.Join(n.to, ", "),
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	if _, err := fmt.Fprintf(w, "%s\r\n\r\n%s", strings.Join(headers, "\r\n"), strings.ReplaceAll(body, "\n", "\r\n")); err != nil {
+		return fmt.Errorf("error while sending email: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error while sending email: %s", err)
+	}
+	return c.Quit()
+}
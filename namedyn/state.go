@@ -0,0 +1,105 @@
+package namedyn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// appliedRecord is the last known state of a record.
+type appliedRecord struct {
+	// Answers contains the answers of all records of the host and type.
+	Answers []string `json:"answers"`
+	// IDs contains the provider specific identifiers of the records.
+	IDs []string `json:"ids"`
+	// Synced is the time the record was last looked up.
+	Synced time.Time `json:"synced"`
+	// TTL, Priority, Weight, Port and Options are the applied settings of the
+	// records, so changing them in the configuration is applied without waiting
+	// for the next resync. They are zero in state files of older versions.
+	TTL      int32 `json:"ttl,omitempty"`
+	Priority int32 `json:"priority,omitempty"`
+	Weight   int32 `json:"weight,omitempty"`
+	Port     int32 `json:"port,omitempty"`
+	// Options are the options applied by the provider, e.g. proxied.
+	Options map[string]string `json:"options,omitempty"`
+	// Conflicts contains the answers of the records of others which have not
+	// been overwritten because of WarnOnConflict, so they are only warned
+	// about once. The records are not managed by namedyn if it is set.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// matches returns true if the records have been applied using the given
+// answers and the settings of the given entry.
+func (a appliedRecord) matches(e Entry, answers []string) bool {
+	_, options := e.settings()
+	return equalStrings(a.Answers, answers) && a.TTL == e.TTL && a.Priority == e.Priority && a.Weight == e.Weight && a.Port == e.Port && equalOptions(a.Options, options)
+}
+
+// equalOptions returns true if both options contain the same settings.
+func equalOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// state is persisted to the state file.
+type state struct {
+	// Records contains the last applied records by host and type.
+	Records map[string]appliedRecord `json:"records"`
+	// History contains the most recent changes, if the history is enabled.
+	History []Change `json:"history,omitempty"`
+}
+
+// loadState reads the state file at path. A missing or corrupt
+// state file is treated as empty, corrupt files are logged.
+func loadState(path string) state {
+	s := state{Records: make(map[string]appliedRecord)}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("could not read state file, ignoring it", "path", path, "error", err)
+		}
+		return s
+	}
+	var loaded state
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		logger.Warn("could not parse state file, ignoring it", "path", path, "error", err)
+		return s
+	}
+	for k, r := range loaded.Records {
+		s.Records[k] = r
+	}
+	s.History = loaded.History
+	return s
+}
+
+// saveState writes the given state to the state file at path. The file is
+// replaced atomically, so it does not get corrupted if the process is killed.
+func saveState(path string, s state) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,53 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TelegramNotifier sends changes as messages using the telegram bot api.
+type TelegramNotifier struct {
+	cli    Doer
+	token  string
+	chatID string
+}
+
+// NewTelegramNotifier returns a notifier sending changes to the
+// given chat using the bot with the given token.
+func NewTelegramNotifier(cli Doer, token, chatID string) *TelegramNotifier {
+	return &TelegramNotifier{
+		cli:    cli,
+		token:  token,
+		chatID: chatID,
+	}
+}
+
+// Notify sends the given change to the telegram chat.
+func (n *TelegramNotifier) Notify(ctx context.Context, c Change) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": n.chatID,
+		"text":    c.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating telegram request body: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.token), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error while creating telegram request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := timedDo(n.cli, "notify", req)
+	if err != nil {
+		// the error contains the url, which must not leak the token
+		return fmt.Errorf("error while sending telegram message: %s", redact(err.Error(), n.token))
+	}
+	defer res.Body.Close()
+	if !successful(res) {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("unexpected status code %v while sending telegram message: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package namedyn
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// NewTransport returns the transport used for all requests. Requests are sent
+// through the proxy at proxyURL if it is not empty or otherwise through the
+// proxy configured by HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func NewTransport(proxyURL string) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if proxyURL == "" {
+		return t, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, needs to be one of http, https, socks5 or socks5h", u.Scheme)
+	}
+	t.Proxy = http.ProxyURL(u)
+	return t, nil
+}
+
+// UserAgentTransport sets the user agent of all requests.
+type UserAgentTransport struct {
+	Base      http.RoundTripper
+	UserAgent string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *UserAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request must not be modified by a round tripper
+	r := req.Clone(req.Context())
+	r.Header.Set("User-Agent", t.UserAgent)
+	return t.Base.RoundTrip(r)
+}
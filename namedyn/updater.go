@@ -0,0 +1,940 @@
+package namedyn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Updater keeps the dynamic records of the configured entries up to date.
+// It is created by NewUpdater, the exported fields configure it and must
+// not be changed once the first cycle has been started.
+type Updater struct {
+	cli      Doer
+	entries  []Entry
+	families []IPFamily
+	// DryRun only logs the changes instead of applying them.
+	DryRun bool
+	// WarnOnConflict refuses to change existing records pointing to other
+	// answers the first time they are handled, unless AllowOverwrite is set.
+	WarnOnConflict bool
+	AllowOverwrite bool
+	// MarkRecords marks the records of a host and type as managed by namedyn
+	// using a companion txt record once they have been changed.
+	MarkRecords bool
+	// StrictOwnership only updates or deletes records marked as managed by
+	// namedyn, it implies MarkRecords.
+	StrictOwnership bool
+	// UpdateOnly never creates records, they need to exist already.
+	UpdateOnly bool
+	// Duplicates defines how multiple records of a host with a single answer
+	// are handled, either first to only update the first one, all to update
+	// all of them or delete to delete all but the first one.
+	Duplicates string
+	// MultipleIPs publishes a record for each of multiple own public ips
+	// and deletes the other records of the hosts.
+	MultipleIPs bool
+	// Resync is the interval after which records are looked up
+	// again, even if the own public ip has not changed.
+	Resync time.Duration
+	// Concurrency is the maximum number of records handled at the same time.
+	Concurrency int
+	mu          sync.Mutex
+	// applied contains the last applied records by host and type.
+	applied map[string]appliedRecord
+	// StateFile is the path the applied records are persisted to, if not empty.
+	StateFile string
+	// owned contains the records created or updated by this process
+	// by host, type and id, which may be deleted on exit.
+	owned map[string]ownedRecord
+	// failures contains the number of consecutive failures by host and type.
+	failures map[string]int
+	// AlertAfter is the number of consecutive failures of a
+	// record after which the alerters get alerted.
+	AlertAfter int
+	// Notifiers get notified about created or updated records.
+	Notifiers []Notifier
+	// Verifier checks whether changes have propagated, if not nil.
+	Verifier *DNSVerifier
+	// verifying waits for the running propagation checks.
+	verifying sync.WaitGroup
+	// Health keeps track of the outcome of the cycles, if not nil.
+	Health *Health
+	// History keeps the most recent changes, if not nil. They are
+	// persisted to the state file together with the applied records.
+	History *History
+	// Timeout bounds the duration of a cycle, it is disabled if zero.
+	Timeout time.Duration
+	// ListTimeout and UpdateTimeout bound the duration of looking up
+	// and of changing records, they are disabled if zero.
+	ListTimeout   time.Duration
+	UpdateTimeout time.Duration
+	// ConfirmChanges is the number of consecutive cycles a changed own
+	// public ip needs to be looked up before the records are changed.
+	ConfirmChanges int
+	// confirmed contains the last confirmed own public ips by type.
+	confirmed map[string][]string
+	// pending contains the changed own public ips waiting for confirmation by type.
+	pending map[string]pendingIPs
+	// BreakerThreshold is the number of consecutive failed records of a provider
+	// and domain after which the circuit breaker pauses handling their records
+	// for BreakerCooldown. The circuit breakers are disabled if it is zero.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// breakers contains the circuit breakers by provider and domain.
+	breakers map[string]*breaker
+}
+
+// NewUpdater returns an updater managing the records of the given entries
+// using the given client. The own public ips are looked up using the given
+// families, there needs to be one for every type of the entries pointing
+// to the own public ip.
+func NewUpdater(cli Doer, entries []Entry, families []IPFamily) *Updater {
+	return &Updater{
+		cli:              cli,
+		entries:          entries,
+		families:         families,
+		Duplicates:       "first",
+		Resync:           time.Hour,
+		Concurrency:      4,
+		AlertAfter:       3,
+		ConfirmChanges:   1,
+		BreakerThreshold: 5,
+		BreakerCooldown:  10 * time.Minute,
+		applied:          make(map[string]appliedRecord),
+		owned:            make(map[string]ownedRecord),
+		failures:         make(map[string]int),
+		confirmed:        make(map[string][]string),
+		pending:          make(map[string]pendingIPs),
+		breakers:         make(map[string]*breaker),
+	}
+}
+
+// LoadState restores the last applied records and the history from the state
+// file, if configured, so the records are not looked up again after a restart.
+func (u *Updater) LoadState() {
+	if u.StateFile == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := loadState(u.StateFile)
+	u.applied = s.Records
+	u.History.restore(s.History)
+}
+
+// SelfTest looks up the record of the first entry of every provider to
+// verify the credentials. Only rejected credentials are considered an error,
+// other errors are logged and handled by the cycles.
+func SelfTest(ctx context.Context, entries []Entry) error {
+	tested := make(map[Provider]bool)
+	for _, e := range entries {
+		if tested[e.Provider] {
+			continue
+		}
+		tested[e.Provider] = true
+		_, err := e.Provider.FindRecords(ctx, e.Host, e.Type)
+		if errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("self-test failed for %s: %s", e.Hostname(), err)
+		}
+		if errors.Is(err, ErrDomainNotFound) {
+			return fmt.Errorf("self-test failed for %s, check the domain: %s", e.Hostname(), err)
+		}
+		if err != nil {
+			ctxLogger(ctx).Warn("self-test could not verify credentials", "host", e.Hostname(), "type", e.Type, "error", err)
+		}
+	}
+	return nil
+}
+
+// pendingIPs are changed own public ips which have been looked up count
+// consecutive times.
+type pendingIPs struct {
+	ips   []string
+	count int
+}
+
+// Cycle looks up the own public ip and creates or updates the records
+// of all entries if necessary. It returns false if any of them failed.
+// Cycles must not be run concurrently.
+func (u *Updater) Cycle(ctx context.Context) bool {
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	ctx = withCycleID(ctx)
+	ok := true
+	// the records are handled independently, so a failure
+	// on one of them does not block the other one
+	var jobs []job
+	for _, f := range u.families {
+		// the own public ip is only looked up once per cycle
+		ips, err := f.lookupIPs(ctx, u.cli)
+		if err != nil && f.Optional {
+			ctxLogger(ctx).Warn("no own ip available, skipping optional records", "type", f.Type, "error", err)
+			continue
+		}
+		if err != nil {
+			ctxLogger(ctx).Error("error while looking up own ip", "type", f.Type, "error", err)
+			errorsTotal.add(1, "ip")
+			ok = false
+			continue
+		}
+		ctxLogger(ctx).Debug("looked up own ip", "type", f.Type, "ip", strings.Join(ips, ","))
+		ips = u.confirm(ctx, f.Type, ips)
+		publicIPInfo.replace(1, f.Type, ips[0])
+		for _, ip := range ips[1:] {
+			publicIPInfo.set(1, f.Type, ip)
+		}
+		for _, e := range u.entries {
+			if e.Type == f.Type && e.Target == "" {
+				jobs = append(jobs, job{entry: e, answers: ips})
+			}
+		}
+	}
+	// records with a static target do not depend on the own public ip
+	for _, e := range u.entries {
+		if e.Target != "" {
+			jobs = append(jobs, job{entry: e, answers: []string{e.Target}})
+		}
+	}
+	if !u.runAll(ctx, jobs) {
+		ok = false
+	}
+	lastCycleTimestamp.set(float64(time.Now().Unix()))
+	if ok {
+		lastSuccessTimestamp.set(float64(time.Now().Unix()))
+		u.saveState()
+	}
+	u.Health.record(ok)
+	return ok
+}
+
+// confirm returns the own public ips of the given type to publish. Changed ips
+// are only returned once they have been looked up for ConfirmChanges consecutive
+// cycles, the last confirmed ones are returned until then. This prevents
+// updates caused by echo services returning transient ips.
+func (u *Updater) confirm(ctx context.Context, typ string, ips []string) []string {
+	if u.ConfirmChanges <= 1 {
+		return ips
+	}
+	confirmed, ok := u.confirmed[typ]
+	// the ips looked up first are published, as there is nothing to compare them to
+	if !ok || equalStrings(confirmed, ips) {
+		u.confirmed[typ] = ips
+		delete(u.pending, typ)
+		return ips
+	}
+	p := u.pending[typ]
+	if !equalStrings(p.ips, ips) {
+		p = pendingIPs{ips: ips}
+	}
+	p.count++
+	if p.count >= u.ConfirmChanges {
+		ctxLogger(ctx).Info("own ip change confirmed", "type", typ, "ip", strings.Join(ips, ","), "old_ip", strings.Join(confirmed, ","))
+		u.confirmed[typ] = ips
+		delete(u.pending, typ)
+		return ips
+	}
+	ctxLogger(ctx).Info("own ip change pending confirmation", "type", typ, "ip", strings.Join(ips, ","), "current_ip", strings.Join(confirmed, ","), "observed", p.count, "required", u.ConfirmChanges)
+	u.pending[typ] = p
+	return confirmed
+}
+
+// job is a record to be created or updated with the given answers,
+// there is one record per answer.
+type job struct {
+	entry   Entry
+	answers []string
+}
+
+// runAll runs the given jobs concurrently, but at most concurrency at
+// the same time. It returns false if any of them failed.
+func (u *Updater) runAll(ctx context.Context, jobs []job) bool {
+	n := u.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	results := make([]bool, len(jobs))
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, j job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b := u.breaker(j.entry)
+			if b != nil && !b.allow(ctx) {
+				ctxLogger(ctx).Warn("circuit breaker open, skipping record", "host", j.entry.Hostname(), "type", j.entry.Type, "provider", b.provider)
+				u.track(ctx, j.entry, false)
+				return
+			}
+			changes, err := u.run(ctx, j.entry, j.answers)
+			u.report(ctx, j, changes, err)
+			results[i] = err == nil
+			if b != nil {
+				b.record(ctx, results[i])
+			}
+			u.track(ctx, j.entry, results[i])
+		}(i, j)
+	}
+	wg.Wait()
+	for _, ok := range results {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// breaker returns the circuit breaker of the provider and domain
+// of the given entry or nil if the circuit breakers are disabled.
+func (u *Updater) breaker(e Entry) *breaker {
+	if u.BreakerThreshold <= 0 {
+		return nil
+	}
+	name := ProviderName(e.Provider)
+	key := name + "/" + e.Domain
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b, ok := u.breakers[key]
+	if !ok {
+		b = &breaker{provider: name, domain: e.Domain, threshold: u.BreakerThreshold, cooldown: u.BreakerCooldown}
+		b.setState(closed)
+		u.breakers[key] = b
+	}
+	return b
+}
+
+// action describes what has been done to a record.
+type action int
+
+const (
+	created action = iota
+	updated
+	deleted
+)
+
+// String returns the name of the action as used by the metrics.
+func (a action) String() string {
+	switch a {
+	case created:
+		return "create"
+	case updated:
+		return "update"
+	}
+	return "delete"
+}
+
+// recordChange describes a change made to one of the records of an entry.
+type recordChange struct {
+	action action
+	// old contains the record before it has been updated or deleted.
+	old *Record
+	// rec contains the created or updated record.
+	rec *Record
+	// refreshed is true if the record has been set to the answer it already
+	// had, as the provider is unable to look up whether it changed.
+	refreshed bool
+}
+
+// stageError is returned if handling a record failed,
+// stage is the failed step as used by the metrics.
+type stageError struct {
+	stage string
+	msg   string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.msg, e.err)
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// run creates, updates or deletes the records of the given entry if necessary,
+// so there is one record per answer. The answers are the own public ips for A
+// and AAAA records. Unless multiple ips are enabled, there is only one answer
+// and only the first existing record is taken into account, so other records
+// of the host are left alone. It returns the changes made to the records,
+// which is empty if they were up to date. In dry run mode, the changes which
+// would have been made are returned instead.
+func (u *Updater) run(ctx context.Context, e Entry, answers []string) ([]recordChange, error) {
+	host, typ := e.Host, e.Type
+	// the found records are compared with the settings applied by the provider
+	ttl, options := e.settings()
+	hostname := e.Hostname()
+	key := hostname + "/" + typ
+	// the records do not need to be looked up if neither the answers nor the
+	// settings have changed, unless it is time to resync them to recover from
+	// changes made by others
+	u.mu.Lock()
+	a, ok := u.applied[key]
+	u.mu.Unlock()
+	// the records of others which have not been overwritten are not managed
+	// by namedyn, they are looked up in every cycle until they are gone
+	var conflicts []string
+	if ok && len(a.Conflicts) > 0 {
+		conflicts, ok = a.Conflicts, false
+	}
+	if ok && a.matches(e, answers) && time.Since(a.Synced) < u.Resync {
+		ctxLogger(ctx).Debug("answer has not changed since last sync, skipping lookup", "host", hostname, "type", typ, "answer", strings.Join(answers, ","), "synced", a.Synced)
+		unchangedTotal.add(1, typ)
+		return nil, nil
+	}
+	// query current records
+	listCtx, cancel := withTimeout(ctx, u.ListTimeout)
+	records, err := e.Provider.FindRecords(listCtx, host, typ)
+	cancel()
+	if errors.Is(err, ErrDomainNotFound) {
+		return nil, &stageError{stage: "lookup", msg: "domain not found, check the configured domain", err: err}
+	}
+	if err != nil {
+		return nil, &stageError{stage: "lookup", msg: "error while looking for existing record", err: err}
+	}
+	marking := u.MarkRecords || u.StrictOwnership
+	var marked bool
+	if marking {
+		if marked, err = u.managed(ctx, e); err != nil {
+			return nil, &stageError{stage: "lookup", msg: "error while looking for managed-by marker", err: err}
+		}
+	}
+	// duplicates are records of a host pointing to a single answer,
+	// they are kept, updated as well or deleted depending on the configuration
+	var duplicates []*Record
+	if len(records) > 1 && !u.MultipleIPs && typ != "TXT" {
+		ids := make([]string, len(records))
+		for i, r := range records {
+			ids[i] = r.ID
+		}
+		ctxLogger(ctx).Warn("found duplicate records", "host", hostname, "type", typ, "ids", strings.Join(ids, ","), "handling", u.Duplicates)
+		switch u.Duplicates {
+		case "all":
+			duplicates = records[1:]
+			records = records[:1]
+		case "delete":
+			// the extra records are deleted like the stale ones of multiple ips
+		default:
+			records = records[:1]
+		}
+	}
+	// records already pointing to one of the answers are kept,
+	// the other ones are reused for the missing answers
+	var kept, stale []*Record
+	found := make(map[string]bool)
+	for _, r := range records {
+		ctxLogger(ctx).Debug("found record", "host", hostname, "type", typ, "id", r.ID, "current_answer", r.Answer, "ttl", ttl, "current_ttl", r.TTL)
+		// the answers have been normalized when the entries were parsed
+		answer := NormalizeAnswer(typ, r.Answer)
+		if containsString(answers, answer) && !found[answer] {
+			found[answer] = true
+			kept = append(kept, r)
+			continue
+		}
+		// a host may have multiple txt records, e.g. for acme challenges or
+		// domain verifications, so the other ones are left alone
+		if typ == "TXT" {
+			continue
+		}
+		stale = append(stale, r)
+	}
+	if len(records) == 0 {
+		ctxLogger(ctx).Debug("record does not exist", "host", hostname, "type", typ)
+	}
+	var missing []string
+	for _, answer := range answers {
+		if !found[answer] {
+			missing = append(missing, answer)
+		}
+	}
+	// records which have never been managed by namedyn and point somewhere
+	// else may have been set intentionally, so they are not overwritten
+	if !ok && u.WarnOnConflict && len(stale) > 0 {
+		current := make([]string, len(stale))
+		for i, r := range stale {
+			current[i] = NormalizeAnswer(typ, r.Answer)
+		}
+		// the conflict is only warned about again once the records of others change
+		if !u.AllowOverwrite && equalStrings(conflicts, current) {
+			ctxLogger(ctx).Debug("record still points to another answer, not overwriting it without ALLOW_OVERWRITE", "host", hostname, "type", typ, "answer", strings.Join(answers, ","), "current_answer", strings.Join(current, ","))
+			return nil, nil
+		}
+		for _, r := range stale {
+			if !u.AllowOverwrite {
+				ctxLogger(ctx).Warn("record points to another answer, not overwriting it without ALLOW_OVERWRITE", "host", hostname, "type", typ, "answer", strings.Join(answers, ","), "current_answer", r.Answer)
+				continue
+			}
+			ctxLogger(ctx).Warn("overwriting record pointing to another answer", "host", hostname, "type", typ, "answer", strings.Join(answers, ","), "current_answer", r.Answer)
+		}
+		// the records are skipped, which is neither a change nor up to date
+		if !u.AllowOverwrite {
+			if !u.DryRun {
+				u.setConflicts(key, current)
+			}
+			return nil, nil
+		}
+	}
+	var changes []recordChange
+	var ids []string
+	var skipped bool
+	// records of write-only providers are set again on every resync, which
+	// is not reported as a change if the answers were already applied
+	_, writeOnly := e.Provider.(writeOnlyProvider)
+	refreshed := writeOnly && ok && equalStrings(a.Answers, answers)
+	apply := func(c recordChange, stage, msg string, f func(context.Context, *Record) error) error {
+		c.refreshed = refreshed
+		if c.rec != nil {
+			c.rec.Priority, c.rec.Weight, c.rec.Port = e.Priority, e.Weight, e.Port
+			c.rec.Options = e.Options
+		}
+		// records created by others are left alone, they are looked up again in the next cycle
+		if c.action != created && u.StrictOwnership && !marked {
+			ctxLogger(ctx).Warn("record is not managed by namedyn, not changing it with strict ownership", "host", hostname, "type", typ, "id", c.old.ID, "current_answer", c.old.Answer)
+			skipped = true
+			return nil
+		}
+		if !u.DryRun {
+			target := c.rec
+			if c.action == deleted {
+				target = c.old
+			}
+			updateCtx, cancel := withTimeout(ctx, u.UpdateTimeout)
+			err := f(updateCtx, target)
+			cancel()
+			if err != nil {
+				return &stageError{stage: stage, msg: msg, err: err}
+			}
+			u.own(e, c)
+			// deleted records do not need to be marked, the marker would be deleted below
+			if marking && !marked && c.action != deleted {
+				if err := u.mark(ctx, e); err != nil {
+					return &stageError{stage: "create", msg: "error while creating managed-by marker", err: err}
+				}
+				ctxLogger(ctx).Info("marked records as managed by namedyn", "host", hostname, "type", typ, "marker", markerHost(host))
+				marked = true
+			}
+		}
+		changes = append(changes, c)
+		return nil
+	}
+	// most providers do not report the options of the found records, so the
+	// records are also updated if the options changed since they were applied
+	optionsChanged := ok && !equalOptions(a.Options, options)
+	// the ttl and priority of the kept records are updated if necessary, changed
+	// answers are updated together with them using a single request below
+	for _, r := range kept {
+		if r.TTL != ttl {
+			ctxLogger(ctx).Info("ttl of record differs from the configured one", "host", hostname, "type", typ, "id", r.ID, "answer", r.Answer, "ttl", ttl, "current_ttl", r.TTL)
+		}
+		if r.Priority != e.Priority {
+			ctxLogger(ctx).Info("priority of record differs from the configured one", "host", hostname, "type", typ, "id", r.ID, "answer", r.Answer, "priority", e.Priority, "current_priority", r.Priority)
+		}
+		if r.Weight != e.Weight || r.Port != e.Port {
+			ctxLogger(ctx).Info("weight or port of record differs from the configured one", "host", hostname, "type", typ, "id", r.ID, "answer", r.Answer, "weight", e.Weight, "current_weight", r.Weight, "port", e.Port, "current_port", r.Port)
+		}
+		if !reportedOptionsMatch(r.Options, options) {
+			ctxLogger(ctx).Info("options of record differ from the configured ones", "host", hostname, "type", typ, "id", r.ID, "answer", r.Answer, "options", formatOptions(options), "current_options", formatOptions(r.Options))
+		} else if optionsChanged {
+			ctxLogger(ctx).Info("options have changed since they were applied to the record", "host", hostname, "type", typ, "id", r.ID, "answer", r.Answer, "options", formatOptions(options), "applied_options", formatOptions(a.Options))
+		}
+		if r.TTL != ttl || r.Priority != e.Priority || r.Weight != e.Weight || r.Port != e.Port || !reportedOptionsMatch(r.Options, options) || optionsChanged {
+			old := *r
+			r.TTL = ttl
+			if err := apply(recordChange{action: updated, old: &old, rec: r}, "update", "error while updating record", e.Provider.UpdateRecord); err != nil {
+				return changes, err
+			}
+		}
+		ids = append(ids, r.ID)
+	}
+	for i, answer := range missing {
+		if i < len(stale) {
+			// answer or ttl has changed and needs to be updated
+			r := stale[i]
+			old := *r
+			r.Answer = answer
+			r.TTL = ttl
+			if err := apply(recordChange{action: updated, old: &old, rec: r}, "update", "error while updating record", e.Provider.UpdateRecord); err != nil {
+				return changes, err
+			}
+			ids = append(ids, r.ID)
+			continue
+		}
+		if u.UpdateOnly {
+			ctxLogger(ctx).Warn("record does not exist, not creating it in update-only mode", "host", hostname, "type", typ, "answer", answer)
+			// the records are looked up again in the next cycle
+			skipped = true
+			continue
+		}
+		// create record
+		r := &Record{
+			Host:   host,
+			Type:   typ,
+			Answer: answer,
+			TTL:    ttl,
+		}
+		if err := apply(recordChange{action: created, rec: r}, "create", "error while creating record", e.Provider.CreateRecord); err != nil {
+			return changes, err
+		}
+		ids = append(ids, r.ID)
+	}
+	for _, r := range duplicates {
+		if NormalizeAnswer(typ, r.Answer) == answers[0] && r.TTL == ttl && r.Priority == e.Priority && r.Weight == e.Weight && r.Port == e.Port && reportedOptionsMatch(r.Options, options) && !optionsChanged {
+			ids = append(ids, r.ID)
+			continue
+		}
+		old := *r
+		r.Answer = answers[0]
+		r.TTL = ttl
+		if err := apply(recordChange{action: updated, old: &old, rec: r}, "update", "error while updating record", e.Provider.UpdateRecord); err != nil {
+			return changes, err
+		}
+		ids = append(ids, r.ID)
+	}
+	// the remaining records do not point to any of the answers anymore
+	for i := len(missing); i < len(stale); i++ {
+		if err := apply(recordChange{action: deleted, old: stale[i]}, "delete", "error while deleting record", e.Provider.DeleteRecord); err != nil {
+			return changes, err
+		}
+	}
+	if marked && len(ids) == 0 && len(stale) > len(missing) && !skipped && !u.DryRun {
+		if err := u.unmark(ctx, e); err != nil {
+			return changes, &stageError{stage: "delete", msg: "error while deleting managed-by marker", err: err}
+		}
+		ctxLogger(ctx).Info("deleted managed-by marker, no records are left", "host", hostname, "type", typ, "marker", markerHost(host))
+	}
+	// without strict ownership, the records already pointing to the answers are
+	// managed by namedyn as well, which allows to adopt them before enabling it
+	if marking && !marked && !u.StrictOwnership && !u.DryRun && len(ids) > 0 {
+		if err := u.mark(ctx, e); err != nil {
+			return changes, &stageError{stage: "create", msg: "error while creating managed-by marker", err: err}
+		}
+		ctxLogger(ctx).Info("marked records as managed by namedyn", "host", hostname, "type", typ, "marker", markerHost(host))
+	}
+	if !u.DryRun && !skipped {
+		u.setApplied(key, e, answers, ids)
+	}
+	if len(changes) == 0 && !skipped {
+		ctxLogger(ctx).Debug("record is up to date", "host", hostname, "type", typ, "answer", strings.Join(answers, ","))
+		unchangedTotal.add(1, typ)
+	}
+	return changes, nil
+}
+
+// report logs the outcome of handling the given job, updates
+// the metrics and notifies the notifiers about changes.
+func (u *Updater) report(ctx context.Context, j job, changes []recordChange, err error) {
+	hostname, typ := j.entry.Hostname(), j.entry.Type
+	for _, c := range changes {
+		var args []interface{}
+		var n Change
+		switch c.action {
+		case created:
+			args = []interface{}{"host", hostname, "type", typ}
+			// records are not created in a dry run, so they do not have an id
+			if c.rec.ID != "" {
+				args = append(args, "id", c.rec.ID)
+			}
+			args = append(args, "answer", c.rec.Answer, "ttl", c.rec.TTL)
+			switch typ {
+			case "MX":
+				args = append(args, "priority", c.rec.Priority)
+			case "SRV":
+				args = append(args, "priority", c.rec.Priority, "weight", c.rec.Weight, "port", c.rec.Port)
+			}
+			n = Change{Host: hostname, Type: typ, NewIP: c.rec.Answer, Time: time.Now()}
+		case updated:
+			args = []interface{}{"host", hostname, "type", typ, "id", c.rec.ID, "answer", c.rec.Answer, "old_answer", c.old.Answer, "ttl", c.rec.TTL, "old_ttl", c.old.TTL}
+			switch typ {
+			case "MX":
+				args = append(args, "priority", c.rec.Priority, "old_priority", c.old.Priority)
+			case "SRV":
+				args = append(args, "priority", c.rec.Priority, "old_priority", c.old.Priority, "weight", c.rec.Weight, "old_weight", c.old.Weight, "port", c.rec.Port, "old_port", c.old.Port)
+			}
+			n = Change{Host: hostname, Type: typ, OldIP: c.old.Answer, NewIP: c.rec.Answer, Time: time.Now()}
+		case deleted:
+			args = []interface{}{"host", hostname, "type", typ, "id", c.old.ID, "old_answer", c.old.Answer, "old_ttl", c.old.TTL}
+			n = Change{Host: hostname, Type: typ, OldIP: c.old.Answer, Time: time.Now()}
+		}
+		if u.DryRun {
+			ctxLogger(ctx).Info("dry run, would "+c.action.String()+" record", args...)
+			continue
+		}
+		if c.refreshed {
+			ctxLogger(ctx).Info("refreshed record, answer has not changed since it was last applied", args...)
+			unchangedTotal.add(1, typ)
+			continue
+		}
+		// e.g. created record
+		ctxLogger(ctx).Info(c.action.String()+"d record", args...)
+		updatesTotal.add(1, typ, c.action.String())
+		u.notify(ctx, n)
+		// changes of the ttl only are left out of the history
+		if n.OldIP != n.NewIP {
+			u.History.add(n)
+		}
+		if u.Verifier != nil && c.rec != nil && verifiable(typ) {
+			// the check runs in the background, so it does not delay
+			// the cycle, and is not cancelled together with the cycle
+			// context, but keeps logging its cycle id
+			u.verifying.Add(1)
+			go func(answer string) {
+				defer u.verifying.Done()
+				u.Verifier.verify(context.WithoutCancel(ctx), hostname, typ, answer)
+			}(strings.TrimSuffix(c.rec.Answer, "."))
+		}
+	}
+	if err != nil {
+		answer := strings.Join(j.answers, ",")
+		var se *stageError
+		if errors.As(err, &se) {
+			ctxLogger(ctx).Error(se.msg, "host", hostname, "type", typ, "answer", answer, "error", se.err)
+			errorsTotal.add(1, se.stage)
+			return
+		}
+		ctxLogger(ctx).Error("error while handling record", "host", hostname, "type", typ, "answer", answer, "error", err)
+	}
+}
+
+// track keeps track of consecutive failures of the given entry and alerts
+// the notifiers implementing Alerter once the threshold is reached.
+func (u *Updater) track(ctx context.Context, e Entry, ok bool) {
+	key := e.Hostname() + "/" + e.Type
+	u.mu.Lock()
+	if ok {
+		delete(u.failures, key)
+	} else {
+		u.failures[key]++
+	}
+	failures := u.failures[key]
+	u.mu.Unlock()
+	// only alert once when reaching the threshold
+	if failures == 0 || failures != u.AlertAfter {
+		return
+	}
+	a := Alert{Host: e.Hostname(), Type: e.Type, Failures: failures, Time: time.Now()}
+	for _, n := range u.Notifiers {
+		if al, ok := n.(Alerter); ok {
+			if err := al.Alert(ctx, a); err != nil {
+				ctxLogger(ctx).Error("error while sending alert", "host", a.Host, "type", a.Type, "error", err)
+				errorsTotal.add(1, "notify")
+			}
+		}
+	}
+}
+
+// ownedRecord is a record created or updated by this process.
+type ownedRecord struct {
+	entry Entry
+	rec   Record
+}
+
+// own keeps track of the records created or updated by this process.
+func (u *Updater) own(e Entry, c recordChange) {
+	prefix := e.Hostname() + "/" + e.Type + "/"
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if c.old != nil {
+		delete(u.owned, prefix+c.old.ID)
+	}
+	if c.rec != nil {
+		u.owned[prefix+c.rec.ID] = ownedRecord{entry: e, rec: *c.rec}
+	}
+}
+
+// Cleanup deletes the records created or updated by this process. Records
+// which have been changed by others since are left alone. The markers of
+// hosts and types without records left are deleted as well.
+func (u *Updater) Cleanup(ctx context.Context) {
+	u.mu.Lock()
+	owned := make([]ownedRecord, 0, len(u.owned))
+	for _, o := range u.owned {
+		owned = append(owned, o)
+	}
+	u.mu.Unlock()
+	// cleaned contains the entries whose records have been cleaned up by host and type
+	cleaned := make(map[string]Entry)
+	for _, o := range owned {
+		hostname, typ := o.entry.Hostname(), o.entry.Type
+		cleaned[hostname+"/"+typ] = o.entry
+		listCtx, cancel := withTimeout(ctx, u.ListTimeout)
+		records, err := o.entry.Provider.FindRecords(listCtx, o.rec.Host, o.rec.Type)
+		cancel()
+		if err != nil {
+			ctxLogger(ctx).Error("error while looking for record to clean up", "host", hostname, "type", typ, "answer", o.rec.Answer, "error", err)
+			errorsTotal.add(1, "lookup")
+			continue
+		}
+		for _, r := range records {
+			if r.ID != o.rec.ID || r.Answer != o.rec.Answer {
+				continue
+			}
+			updateCtx, cancel := withTimeout(ctx, u.UpdateTimeout)
+			err := o.entry.Provider.DeleteRecord(updateCtx, r)
+			cancel()
+			if err != nil {
+				ctxLogger(ctx).Error("error while deleting record", "host", hostname, "type", typ, "answer", r.Answer, "error", err)
+				errorsTotal.add(1, "delete")
+				continue
+			}
+			ctxLogger(ctx).Info("deleted record", "host", hostname, "type", typ, "id", r.ID, "old_answer", r.Answer, "old_ttl", r.TTL)
+			updatesTotal.add(1, typ, deleted.String())
+			u.notify(ctx, Change{Host: hostname, Type: typ, OldIP: r.Answer, Time: time.Now()})
+		}
+		// the records need to be looked up again after a restart
+		u.mu.Lock()
+		delete(u.owned, hostname+"/"+typ+"/"+o.rec.ID)
+		delete(u.applied, hostname+"/"+typ)
+		u.mu.Unlock()
+	}
+	if u.MarkRecords || u.StrictOwnership {
+		for _, e := range cleaned {
+			u.cleanupMarker(ctx, e)
+		}
+	}
+	u.saveState()
+}
+
+// cleanupMarker deletes the marker of the records of the given entry if there
+// are no records left, so records created later by others are not considered
+// managed by namedyn.
+func (u *Updater) cleanupMarker(ctx context.Context, e Entry) {
+	hostname := e.Hostname()
+	listCtx, cancel := withTimeout(ctx, u.ListTimeout)
+	records, err := e.Provider.FindRecords(listCtx, e.Host, e.Type)
+	cancel()
+	if err != nil {
+		ctxLogger(ctx).Error("error while looking for records left before deleting managed-by marker", "host", hostname, "type", e.Type, "error", err)
+		errorsTotal.add(1, "lookup")
+		return
+	}
+	if len(records) > 0 {
+		return
+	}
+	if err := u.unmark(ctx, e); err != nil {
+		ctxLogger(ctx).Error("error while deleting managed-by marker", "host", hostname, "type", e.Type, "error", err)
+		errorsTotal.add(1, "delete")
+		return
+	}
+	ctxLogger(ctx).Info("deleted managed-by marker, no records are left", "host", hostname, "type", e.Type, "marker", markerHost(e.Host))
+}
+
+// Wait waits for the propagation checks started by the cycles, which
+// would be aborted by exiting.
+func (u *Updater) Wait() {
+	u.verifying.Wait()
+}
+
+// setApplied stores the given answers, the settings of the given entry and the
+// ids as the last applied ones of the given records.
+func (u *Updater) setApplied(key string, e Entry, answers, ids []string) {
+	_, options := e.settings()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.applied[key] = appliedRecord{
+		Answers:  answers,
+		IDs:      ids,
+		Synced:   time.Now(),
+		TTL:      e.TTL,
+		Priority: e.Priority,
+		Weight:   e.Weight,
+		Port:     e.Port,
+		Options:  options,
+	}
+}
+
+// setConflicts stores the given answers of the records of others, which have
+// not been overwritten, as the conflicts of the given records.
+func (u *Updater) setConflicts(key string, answers []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.applied[key] = appliedRecord{Conflicts: answers, Synced: time.Now()}
+}
+
+// saveState persists the last applied records and the history
+// to the state file, if configured.
+func (u *Updater) saveState() {
+	if u.StateFile == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := saveState(u.StateFile, state{Records: u.applied, History: u.History.list()}); err != nil {
+		logger.Error("error while saving state file", "path", u.StateFile, "error", err)
+	}
+}
+
+// notify sends the given change to all notifiers. Errors are only logged,
+// as they do not affect the outcome of the change.
+func (u *Updater) notify(ctx context.Context, c Change) {
+	for _, n := range u.Notifiers {
+		if err := n.Notify(ctx, c); err != nil {
+			ctxLogger(ctx).Error("error while sending notification", "host", c.Host, "type", c.Type, "error", err)
+			errorsTotal.add(1, "notify")
+		}
+	}
+}
+
+// withTimeout returns a context derived from ctx which expires after the
+// given timeout, it is only cancellable if the timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// containsString returns true if list contains s.
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reportedOptionsMatch returns true if the options reported by the provider for
+// a found record match the wanted ones. Options which are not reported are not
+// compared, as most providers do not report the options of their records.
+func reportedOptionsMatch(reported, want map[string]string) bool {
+	for k, v := range reported {
+		if w, ok := want[k]; ok && w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// formatOptions formats the given options sorted by key, e.g. proxied=true.
+func formatOptions(options map[string]string) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + options[k]
+	}
+	return strings.Join(keys, ",")
+}
+
+// equalStrings returns true if both lists contain the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,738 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCycleNameCom(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name   string
+		pages  [][]NameRecord
+		status map[string]int
+		// ok is the expected result of the cycle.
+		ok       bool
+		requests []string
+	}{
+		{
+			name:  "record not found",
+			pages: [][]NameRecord{{{Id: 1, Host: "nas", Type: "A", Answer: "198.51.100.1", TTL: 300}}},
+			ok:    true,
+			requests: []string{
+				list,
+				`POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+		{
+			name:     "record with the same ip",
+			pages:    [][]NameRecord{{{Id: 1, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}}},
+			ok:       true,
+			requests: []string{list},
+		},
+		{
+			name:  "record with another ip",
+			pages: [][]NameRecord{{{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}}},
+			ok:    true,
+			requests: []string{
+				list,
+				`PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+		{
+			name: "record on the second page",
+			pages: [][]NameRecord{
+				{{Id: 1, Host: "nas", Type: "A", Answer: "198.51.100.1", TTL: 300}},
+				{{Id: 2, Host: "home", Type: "A", Answer: "198.51.100.2", TTL: 300}},
+			},
+			ok: true,
+			requests: []string{
+				list,
+				"GET /v4/domains/example.com/records?page=2",
+				`PUT /v4/domains/example.com/records/2 {"id":2,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+		{
+			name:     "list error",
+			status:   map[string]int{http.MethodGet: http.StatusInternalServerError},
+			requests: []string{list},
+		},
+		{
+			name:   "create error",
+			status: map[string]int{http.MethodPost: http.StatusInternalServerError},
+			requests: []string{
+				list,
+				`POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+		{
+			name:   "update error",
+			pages:  [][]NameRecord{{{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}}},
+			status: map[string]int{http.MethodPut: http.StatusInternalServerError},
+			requests: []string{
+				list,
+				`PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{pages: tt.pages, status: tt.status}
+			p := newNameServer(t, s)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			if ok := u.Cycle(context.Background()); ok != tt.ok {
+				t.Errorf("got cycle result %v, want %v", ok, tt.ok)
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCycleFindsRecordOnSecondPage(t *testing.T) {
+	s := &nameServer{pages: [][]NameRecord{
+		{{Id: 1, Host: "nas", Type: "A", Answer: "198.51.100.1", TTL: 300}},
+		{{Id: 2, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+	}}
+	p := newNameServer(t, s)
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	// the record on the last page must not be created again
+	want := []string{
+		"GET /v4/domains/example.com/records?page=1",
+		"GET /v4/domains/example.com/records?page=2",
+	}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("got requests %q, want %q", s.requests, want)
+	}
+}
+
+func TestCycleCreatesApexRecord(t *testing.T) {
+	s := &nameServer{pages: [][]NameRecord{{{Id: 1, Host: "www", Type: "A", Answer: "203.0.113.1", TTL: 300}}}}
+	p := newNameServer(t, s)
+	e := Entry{Host: "", Domain: "example.com", Type: "A", TTL: 300, Provider: p}
+	if got := e.Hostname(); got != "example.com" {
+		t.Errorf("got hostname %q, want %q", got, "example.com")
+	}
+	u := NewUpdater(http.DefaultClient, []Entry{e}, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	if !u.Cycle(context.Background()) {
+		t.Fatal("cycle failed")
+	}
+	// the record of www must not be mistaken for the apex record
+	want := []string{
+		"GET /v4/domains/example.com/records?page=1",
+		`POST /v4/domains/example.com/records {"id":0,"host":"","type":"A","answer":"203.0.113.1","ttl":300}`,
+	}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("got requests %q, want %q", s.requests, want)
+	}
+}
+
+func TestCycleCNAMETrailingDot(t *testing.T) {
+	s := &nameServer{pages: [][]NameRecord{{{Id: 1, Host: "www", Type: "CNAME", Answer: "Target.Example.net.", TTL: 300}}}}
+	p := newNameServer(t, s)
+	entries := []Entry{{Host: "www", Domain: "example.com", Type: "CNAME", Target: "target.example.net", TTL: 300, Provider: p}}
+	u := NewUpdater(http.DefaultClient, entries, nil)
+	u.Resync = 0
+	for i := 0; i < 2; i++ {
+		if !u.Cycle(context.Background()) {
+			t.Fatal("cycle failed")
+		}
+	}
+	// the fully qualified target must not be treated as another answer
+	want := []string{
+		"GET /v4/domains/example.com/records?page=1",
+		"GET /v4/domains/example.com/records?page=1",
+	}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("got requests %q, want %q", s.requests, want)
+	}
+}
+
+// captureLogs returns the buffer receiving the logs until the end of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := logger
+	logger = slog.New(newTextHandler(&buf))
+	t.Cleanup(func() { logger = prev })
+	return &buf
+}
+
+func TestCycleDuplicates(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name       string
+		duplicates string
+		records    []NameRecord
+		requests   []string
+	}{
+		{
+			name:       "update the first",
+			duplicates: "first",
+			records: []NameRecord{
+				{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+				{Id: 2, Host: "home", Type: "A", Answer: "198.51.100.2", TTL: 300},
+			},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:       "update all",
+			duplicates: "all",
+			records: []NameRecord{
+				{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+				{Id: 2, Host: "home", Type: "A", Answer: "198.51.100.2", TTL: 300},
+			},
+			requests: []string{
+				list,
+				`PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+				`PUT /v4/domains/example.com/records/2 {"id":2,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+			},
+		},
+		{
+			name:       "delete the extras",
+			duplicates: "delete",
+			records: []NameRecord{
+				{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+				{Id: 2, Host: "home", Type: "A", Answer: "198.51.100.2", TTL: 300},
+			},
+			requests: []string{
+				list,
+				`PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`,
+				"DELETE /v4/domains/example.com/records/2",
+			},
+		},
+		{
+			name:       "delete the extras keeping the matching one",
+			duplicates: "delete",
+			records: []NameRecord{
+				{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+				{Id: 2, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			},
+			requests: []string{list, "DELETE /v4/domains/example.com/records/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			s := &nameServer{pages: [][]NameRecord{tt.records}}
+			p := newNameServer(t, s)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			u.Duplicates = tt.duplicates
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+			if !strings.Contains(logs.String(), "found duplicate records") || !strings.Contains(logs.String(), "ids=1,2") {
+				t.Errorf("got logs %q, want a warning with the ids of the duplicates", logs.String())
+			}
+		})
+	}
+}
+
+func TestCycleUpdateOnly(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name     string
+		records  []NameRecord
+		requests []string
+	}{
+		{
+			name:     "missing record",
+			requests: []string{list, list},
+		},
+		{
+			name:     "existing record",
+			records:  []NameRecord{{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{pages: [][]NameRecord{tt.records}}
+			p := newNameServer(t, s)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			u.UpdateOnly = true
+			// the missing record is looked up again, but never created
+			for i := 0; i < 2; i++ {
+				u.Cycle(context.Background())
+			}
+			for _, r := range s.requests {
+				if strings.HasPrefix(r, http.MethodPost) {
+					t.Errorf("got request %q in update-only mode", r)
+				}
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCycleWarnOnConflict(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	logs := captureLogs(t)
+	s := &nameServer{pages: [][]NameRecord{{{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300}}}}
+	p := newNameServer(t, s)
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	u.WarnOnConflict = true
+	warning := "record points to another answer"
+	// the record of others is looked up in every cycle, but only warned about once
+	for i := 0; i < 2; i++ {
+		if !u.Cycle(context.Background()) {
+			t.Fatal("cycle failed")
+		}
+	}
+	if n := strings.Count(logs.String(), warning); n != 1 {
+		t.Errorf("got %v warnings, want 1: %s", n, logs.String())
+	}
+	if !reflect.DeepEqual(s.requests, []string{list, list}) {
+		t.Errorf("got requests %q, want two lookups", s.requests)
+	}
+	if a := u.applied["home.example.com/A"]; !reflect.DeepEqual(a.Conflicts, []string{"198.51.100.1"}) || len(a.Answers) != 0 {
+		t.Errorf("got state %+v, want the conflict to be recorded without answers", a)
+	}
+	// the changed record of others is warned about again
+	s.pages[0][0].Answer = "198.51.100.2"
+	u.Cycle(context.Background())
+	if n := strings.Count(logs.String(), warning); n != 2 {
+		t.Errorf("got %v warnings, want 2 after the record changed: %s", n, logs.String())
+	}
+	// the record is managed once the record of others is gone
+	s.pages = nil
+	s.requests = nil
+	u.Cycle(context.Background())
+	want := []string{list, `POST /v4/domains/example.com/records {"id":0,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("got requests %q, want %q", s.requests, want)
+	}
+	if a := u.applied["home.example.com/A"]; len(a.Conflicts) != 0 || !reflect.DeepEqual(a.Answers, []string{"203.0.113.1"}) {
+		t.Errorf("got state %+v, want the applied answer without conflicts", a)
+	}
+}
+
+func TestDomainNotFound(t *testing.T) {
+	s := &nameServer{status: map[string]int{http.MethodGet: http.StatusNotFound}}
+	p := newNameServer(t, s)
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	err := SelfTest(context.Background(), entries)
+	if err == nil || !strings.Contains(err.Error(), "check the domain") {
+		t.Errorf("got self-test error %v, want it to ask to check the domain", err)
+	}
+	logs := captureLogs(t)
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	if u.Cycle(context.Background()) {
+		t.Error("cycle succeeded, want it to fail")
+	}
+	if !strings.Contains(logs.String(), "domain not found, check the configured domain") {
+		t.Errorf("got logs %q, want the domain to be reported", logs.String())
+	}
+	if strings.Contains(logs.String(), "unexpected status code") {
+		t.Errorf("got logs %q, want no generic error", logs.String())
+	}
+}
+
+func TestCycleWildcard(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	records := []NameRecord{
+		{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+		{Id: 2, Host: "*", Type: "A", Answer: "198.51.100.2", TTL: 300},
+	}
+	tests := []struct {
+		host     string
+		hostname string
+		requests []string
+	}{
+		{
+			host:     "*",
+			hostname: "*.example.com",
+			requests: []string{list, `PUT /v4/domains/example.com/records/2 {"id":2,"host":"*","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+		{
+			host:     "*.home",
+			hostname: "*.home.example.com",
+			requests: []string{list, `POST /v4/domains/example.com/records {"id":0,"host":"*.home","type":"A","answer":"203.0.113.1","ttl":300}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			s := &nameServer{pages: [][]NameRecord{records}}
+			p := newNameServer(t, s)
+			e := Entry{Host: tt.host, Domain: "example.com", Type: "A", TTL: 300, Provider: p}
+			if got := e.Hostname(); got != tt.hostname {
+				t.Errorf("got hostname %q, want %q", got, tt.hostname)
+			}
+			u := NewUpdater(http.DefaultClient, []Entry{e}, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCycleTTLDrift(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name     string
+		record   NameRecord
+		requests []string
+		log      string
+	}{
+		{
+			name:     "answer differs",
+			record:   NameRecord{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 300},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			log:      "old_answer=198.51.100.1",
+		},
+		{
+			name:     "ttl differs",
+			record:   NameRecord{Id: 1, Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 3600},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			log:      "ttl of record differs from the configured one",
+		},
+		{
+			name:     "both differ",
+			record:   NameRecord{Id: 1, Host: "home", Type: "A", Answer: "198.51.100.1", TTL: 3600},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"home","type":"A","answer":"203.0.113.1","ttl":300}`},
+			log:      "old_ttl=3600",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			s := &nameServer{pages: [][]NameRecord{{tt.record}}}
+			p := newNameServer(t, s)
+			entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			// a single request updates both the answer and the ttl
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+			if !strings.Contains(logs.String(), tt.log) {
+				t.Errorf("got logs %q, want them to contain %q", logs.String(), tt.log)
+			}
+		})
+	}
+}
+
+func TestCycleMX(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name     string
+		records  []NameRecord
+		requests []string
+	}{
+		{
+			name:     "create",
+			records:  []NameRecord{{Id: 1, Host: "", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{list, `POST /v4/domains/example.com/records {"id":0,"host":"","type":"MX","answer":"mail.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "unchanged",
+			records:  []NameRecord{{Id: 1, Host: "", Type: "MX", Answer: "mail.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list},
+		},
+		{
+			name:     "priority changed",
+			records:  []NameRecord{{Id: 1, Host: "", Type: "MX", Answer: "mail.example.com", TTL: 300, Priority: int32Pointer(20)}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"","type":"MX","answer":"mail.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "target changed",
+			records:  []NameRecord{{Id: 1, Host: "", Type: "MX", Answer: "old.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"","type":"MX","answer":"mail.example.com","ttl":300,"priority":10}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{pages: [][]NameRecord{tt.records}}
+			p := newNameServer(t, s)
+			entries := []Entry{{Domain: "example.com", Type: "MX", Target: "mail.example.com", TTL: 300, Priority: 10, Provider: p}}
+			// the own ip is not looked up for MX records
+			u := NewUpdater(http.DefaultClient, entries, nil)
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+// expireBreaker lets the cooldown of the circuit breaker with the given key pass.
+func expireBreaker(t *testing.T, u *Updater, key string) {
+	t.Helper()
+	b, ok := u.breakers[key]
+	if !ok {
+		t.Fatalf("no circuit breaker %q", key)
+	}
+	b.opened = time.Now().Add(-u.BreakerCooldown)
+}
+
+func TestCycleCircuitBreaker(t *testing.T) {
+	p := &fakeProvider{errs: map[string]error{"find": errors.New("api down")}}
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	u.BreakerThreshold = 3
+	u.BreakerCooldown = time.Hour
+	// look up the records every cycle
+	u.Resync = 0
+	logs := captureLogs(t)
+	steps := []struct {
+		name string
+		// expire lets the cooldown pass before the cycle.
+		expire bool
+		// recover lets the provider succeed from the cycle on.
+		recover bool
+		ok      bool
+		finds   int
+		state   breakerState
+	}{
+		{name: "first failure", finds: 1, state: closed},
+		{name: "second failure", finds: 2, state: closed},
+		{name: "opens after threshold", finds: 3, state: open},
+		{name: "skips while open", finds: 3, state: open},
+		{name: "half-open failure reopens", expire: true, finds: 4, state: open},
+		{name: "skips after reopening", finds: 4, state: open},
+		{name: "half-open recovery closes", expire: true, recover: true, ok: true, finds: 5, state: closed},
+		{name: "passes while closed", ok: true, finds: 6, state: closed},
+	}
+	for _, s := range steps {
+		if s.expire {
+			expireBreaker(t, u, "fake/example.com")
+		}
+		if s.recover {
+			p.errs = nil
+		}
+		if ok := u.Cycle(context.Background()); ok != s.ok {
+			t.Fatalf("%s: got cycle ok %v, want %v", s.name, ok, s.ok)
+		}
+		if p.finds != s.finds {
+			t.Errorf("%s: got %d lookups, want %d", s.name, p.finds, s.finds)
+		}
+		if got := u.breakers["fake/example.com"].state; got != s.state {
+			t.Errorf("%s: got breaker %s, want %s", s.name, got, s.state)
+		}
+	}
+	if !strings.Contains(logs.String(), "circuit breaker open, skipping record") {
+		t.Errorf("got logs %q, want the skipped record to be logged", logs.String())
+	}
+	want := []string{"create home A 203.0.113.1"}
+	if !reflect.DeepEqual(p.calls, want) {
+		t.Errorf("got calls %q, want %q", p.calls, want)
+	}
+}
+
+func TestCycleCircuitBreakerPerProvider(t *testing.T) {
+	failing := &fakeProvider{errs: map[string]error{"find": errors.New("api down")}}
+	s := &nameServer{pages: [][]NameRecord{{{Id: 1, Host: "nas", Type: "A", Answer: "203.0.113.1", TTL: 300}}}}
+	working := newNameServer(t, s)
+	entries := []Entry{
+		{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: failing},
+		{Host: "nas", Domain: "example.com", Type: "A", TTL: 300, Provider: working},
+	}
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	u.BreakerThreshold = 1
+	u.BreakerCooldown = time.Hour
+	// look up the records every cycle
+	u.Resync = 0
+	for i := 0; i < 3; i++ {
+		if u.Cycle(context.Background()) {
+			t.Fatalf("cycle %d succeeded, want it to fail", i)
+		}
+	}
+	if failing.finds != 1 {
+		t.Errorf("got %d lookups of the failing provider, want 1", failing.finds)
+	}
+	if got := u.breakers["fake/example.com"].state; got != open {
+		t.Errorf("got breaker of the failing provider %s, want open", got)
+	}
+	if got := u.breakers["namecom/example.com"].state; got != closed {
+		t.Errorf("got breaker of the working provider %s, want closed", got)
+	}
+	if len(s.requests) != 3 {
+		t.Errorf("got requests %q to the working provider, want one per cycle", s.requests)
+	}
+}
+
+func TestCycleSRV(t *testing.T) {
+	list := "GET /v4/domains/example.com/records?page=1"
+	tests := []struct {
+		name     string
+		records  []NameRecord
+		requests []string
+	}{
+		{
+			name:     "create",
+			requests: []string{list, `POST /v4/domains/example.com/records {"id":0,"host":"_sip._tcp","type":"SRV","answer":"5 5060 sip.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "unchanged",
+			records:  []NameRecord{{Id: 1, Host: "_sip._tcp", Type: "SRV", Answer: "5 5060 sip.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list},
+		},
+		{
+			name:     "weight changed",
+			records:  []NameRecord{{Id: 1, Host: "_sip._tcp", Type: "SRV", Answer: "0 5060 sip.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"_sip._tcp","type":"SRV","answer":"5 5060 sip.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "port changed",
+			records:  []NameRecord{{Id: 1, Host: "_sip._tcp", Type: "SRV", Answer: "5 5061 sip.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"_sip._tcp","type":"SRV","answer":"5 5060 sip.example.com","ttl":300,"priority":10}`},
+		},
+		{
+			name:     "target changed",
+			records:  []NameRecord{{Id: 1, Host: "_sip._tcp", Type: "SRV", Answer: "5 5060 old.example.com", TTL: 300, Priority: int32Pointer(10)}},
+			requests: []string{list, `PUT /v4/domains/example.com/records/1 {"id":1,"host":"_sip._tcp","type":"SRV","answer":"5 5060 sip.example.com","ttl":300,"priority":10}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nameServer{pages: [][]NameRecord{tt.records}}
+			p := newNameServer(t, s)
+			entries := []Entry{{Host: "_sip._tcp", Domain: "example.com", Type: "SRV", Target: "sip.example.com", TTL: 300, Priority: 10, Weight: 5, Port: 5060, Provider: p}}
+			u := NewUpdater(http.DefaultClient, entries, nil)
+			if !u.Cycle(context.Background()) {
+				t.Fatal("cycle failed")
+			}
+			if !reflect.DeepEqual(s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestSkipLookupUnlessSettingsChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  Entry
+		change func(e *Entry)
+		// lookup is true if the records need to be looked up again.
+		lookup bool
+	}{
+		{name: "unchanged", entry: Entry{Type: "A", TTL: 300}, change: func(e *Entry) {}, lookup: false},
+		{name: "ttl", entry: Entry{Type: "A", TTL: 300}, change: func(e *Entry) { e.TTL = 600 }, lookup: true},
+		{name: "priority", entry: Entry{Type: "MX", Target: "mail.example.com", TTL: 300, Priority: 10}, change: func(e *Entry) { e.Priority = 20 }, lookup: true},
+		{name: "weight", entry: Entry{Type: "SRV", Target: "sip.example.com", TTL: 300, Priority: 10, Port: 5060}, change: func(e *Entry) { e.Weight = 5 }, lookup: true},
+		{name: "port", entry: Entry{Type: "SRV", Target: "sip.example.com", TTL: 300, Priority: 10, Port: 5060}, change: func(e *Entry) { e.Port = 5061 }, lookup: true},
+		{name: "options", entry: Entry{Type: "A", TTL: 300, Options: map[string]string{"tag": "home"}}, change: func(e *Entry) { e.Options = map[string]string{"tag": "office"} }, lookup: true},
+	}
+	for _, tt := range tests {
+		for _, restart := range []bool{false, true} {
+			name := tt.name
+			if restart {
+				name += " after restart"
+			}
+			t.Run(name, func(t *testing.T) {
+				p := &fakeProvider{}
+				e := tt.entry
+				e.Host, e.Domain, e.Provider = "home", "example.com", p
+				families := []IPFamily{{Type: "A", Fixed: "203.0.113.1"}}
+				stateFile := filepath.Join(t.TempDir(), "state.json")
+				u := NewUpdater(http.DefaultClient, []Entry{e}, families)
+				u.StateFile = stateFile
+				if !u.Cycle(context.Background()) {
+					t.Fatal("first cycle failed")
+				}
+				tt.change(&e)
+				if restart {
+					u = NewUpdater(http.DefaultClient, []Entry{e}, families)
+					u.StateFile = stateFile
+					u.LoadState()
+				} else {
+					u.entries[0] = e
+				}
+				finds := p.finds
+				if !u.Cycle(context.Background()) {
+					t.Fatal("second cycle failed")
+				}
+				if looked := p.finds > finds; looked != tt.lookup {
+					t.Errorf("looked up %v, want %v", looked, tt.lookup)
+				}
+				r := p.records[0]
+				if r.TTL != e.TTL || r.Priority != e.Priority || r.Weight != e.Weight || r.Port != e.Port || !equalOptions(r.Options, e.Options) {
+					t.Errorf("got record %+v, want the settings of %+v", r, e)
+				}
+			})
+		}
+	}
+}
+
+// changeRecorder is a notifier recording the changes.
+type changeRecorder struct {
+	changes []Change
+}
+
+func (n *changeRecorder) Notify(_ context.Context, c Change) error {
+	n.changes = append(n.changes, c)
+	return nil
+}
+
+func TestCycleNamecheapResync(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-16"?><interface-response><IP>` + r.URL.Query().Get("ip") + `</IP><ErrCount>0</ErrCount><errors /><Done>true</Done></interface-response>`))
+	}))
+	defer srv.Close()
+	p := NewNamecheapProvider(srv.Client(), srv.URL, "password", "example.com")
+	entries := []Entry{{Host: "home", Domain: "example.com", Type: "A", TTL: 300, Provider: p}}
+	u := NewUpdater(http.DefaultClient, entries, []IPFamily{{Type: "A", Fixed: "203.0.113.1"}})
+	// resync every cycle
+	u.Resync = 0
+	n := &changeRecorder{}
+	u.Notifiers = []Notifier{n}
+	u.History = NewHistory(10)
+	steps := []struct {
+		name          string
+		ip            string
+		notifications int
+	}{
+		{name: "first cycle", ip: "203.0.113.1", notifications: 1},
+		{name: "resync", ip: "203.0.113.1", notifications: 1},
+		{name: "changed ip", ip: "203.0.113.2", notifications: 2},
+		{name: "resync after change", ip: "203.0.113.2", notifications: 2},
+	}
+	for i, s := range steps {
+		u.families[0].Fixed = s.ip
+		if !u.Cycle(context.Background()) {
+			t.Fatalf("%s: cycle failed", s.name)
+		}
+		// the address is set again on every resync
+		if requests != i+1 {
+			t.Errorf("%s: got %d requests, want %d", s.name, requests, i+1)
+		}
+		if len(n.changes) != s.notifications {
+			t.Errorf("%s: got notifications %+v, want %d", s.name, n.changes, s.notifications)
+		}
+		if got := len(u.History.list()); got != s.notifications {
+			t.Errorf("%s: got %d changes in the history, want %d", s.name, got, s.notifications)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package namedyn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// upnpSearchAddr is the multicast address used to discover upnp devices (ssdp).
+const upnpSearchAddr = "239.255.255.250:1900"
+
+// upnpSearchTimeout limits how long to wait for a gateway to answer the discovery.
+const upnpSearchTimeout = 2 * time.Second
+
+// upnpServices contains the types of the upnp services able to
+// report the external ip of an internet gateway device.
+var upnpServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnpDevice represents a device of the upnp device description together
+// with its embedded devices.
+type upnpDevice struct {
+	Services []struct {
+		Type       string `xml:"serviceType"`
+		ControlURL string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// lookupUPnPIP asks the internet gateway device of the local network for its
+// external ip using upnp, which works without any external service.
+func lookupUPnPIP(ctx context.Context, cli Doer) (string, error) {
+	location, err := upnpDiscover(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error while discovering upnp internet gateway device: %s", err)
+	}
+	control, service, err := upnpControlURL(ctx, cli, location)
+	if err != nil {
+		return "", fmt.Errorf("error while reading upnp device description from %s: %s", location, err)
+	}
+	ip, err := upnpExternalIP(ctx, cli, control, service)
+	if err != nil {
+		return "", fmt.Errorf("error while querying upnp gateway %s to lookup own ip: %s", control, err)
+	}
+	return ip, nil
+}
+
+// upnpDiscover searches for internet gateway devices and returns the
+// location of the device description of the first one answering.
+func upnpDiscover(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(upnpSearchTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	addr, err := net.ResolveUDPAddr("udp4", upnpSearchAddr)
+	if err != nil {
+		return "", err
+	}
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + upnpSearchAddr + "\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(msg), addr); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				return "", errors.New("no gateway answered")
+			}
+			return "", err
+		}
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+		if location := res.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// upnpControlURL reads the device description at location and returns the
+// control url and the type of the first service reporting the external ip.
+func upnpControlURL(ctx context.Context, cli Doer, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	res, err := timedDo(cli, "ip", req)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if !successful(res) {
+		return "", "", fmt.Errorf("unexpected status code %v", res.StatusCode)
+	}
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	// the description is bounded like the other replies, so a misbehaving
+	// device is not able to exhaust the memory
+	if err := xml.NewDecoder(io.LimitReader(res.Body, maxBodySize)).Decode(&desc); err != nil {
+		return "", "", fmt.Errorf("could not decode the device description: %s", err)
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if desc.URLBase != "" {
+		if base, err = url.Parse(desc.URLBase); err != nil {
+			return "", "", err
+		}
+	}
+	for _, typ := range upnpServices {
+		if control := desc.Device.controlURL(typ); control != "" {
+			ref, err := url.Parse(control)
+			if err != nil {
+				return "", "", err
+			}
+			return base.ResolveReference(ref).String(), typ, nil
+		}
+	}
+	return "", "", errors.New("the device does not provide a wan connection service")
+}
+
+// controlURL returns the control url of the service with the
+// given type of the device or its embedded devices.
+func (d upnpDevice) controlURL(typ string) string {
+	for _, s := range d.Services {
+		if s.Type == typ {
+			return s.ControlURL
+		}
+	}
+	for _, dev := range d.Devices {
+		if control := dev.controlURL(typ); control != "" {
+			return control
+		}
+	}
+	return ""
+}
+
+// upnpExternalIP calls the GetExternalIPAddress action of the given service.
+func upnpExternalIP(ctx context.Context, cli Doer, control, service string) (string, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + service + `"/></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, control, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+service+`#GetExternalIPAddress"`)
+	res, err := timedDo(cli, "ip", req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := readBody(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("error while reading response body: %s", err)
+	}
+	if !successful(res) {
+		return "", fmt.Errorf("unexpected status code %v: %s", res.StatusCode, string(b))
+	}
+	var reply struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.Unmarshal(b, &reply); err != nil {
+		return "", fmt.Errorf("could not decode the reply: %s", err)
+	}
+	if reply.IP == "" {
+		return "", errors.New("the gateway did not report an external ip")
+	}
+	return reply.IP, nil
+}
@@ -0,0 +1,114 @@
+package namedyn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// resolver resolves the records checked by the verifier, implemented by net.Resolver.
+type resolver interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// DNSVerifier checks whether changed records have propagated
+// by resolving them until they return the expected answer.
+type DNSVerifier struct {
+	resolver resolver
+	// timeout bounds the duration of a check.
+	timeout time.Duration
+	// interval is the time between the lookups of a check.
+	interval time.Duration
+}
+
+// NewDNSVerifier returns a verifier resolving the records using the name
+// server at the given address or the resolvers of the system if it is empty.
+func NewDNSVerifier(server string, timeout time.Duration) *DNSVerifier {
+	var r resolver = net.DefaultResolver
+	if server != "" {
+		r = serverResolver(server)
+	}
+	return &DNSVerifier{resolver: r, timeout: timeout, interval: 5 * time.Second}
+}
+
+// verify resolves the given record until it returns the given answer or the
+// timeout is reached and logs whether the change has propagated.
+func (v *DNSVerifier) verify(ctx context.Context, hostname, typ, answer string) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	start := time.Now()
+	name := hostname
+	// wildcards can not be resolved directly, so a name
+	// matched by the wildcard is resolved instead
+	if strings.HasPrefix(name, "*.") {
+		name = "namedyn-verify" + name[1:]
+	}
+	for {
+		answers, err := v.lookup(ctx, name, typ)
+		if containsString(answers, answer) {
+			ctxLogger(ctx).Info("change has propagated", "host", hostname, "type", typ, "answer", answer, "duration", time.Since(start).Round(time.Millisecond))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			args := []interface{}{"host", hostname, "type", typ, "answer", answer, "resolved", strings.Join(answers, ",")}
+			if err != nil {
+				args = append(args, "error", err)
+			}
+			ctxLogger(ctx).Warn("change has not propagated within the timeout", args...)
+			return
+		case <-time.After(v.interval):
+		}
+	}
+}
+
+// verifiable returns whether the verifier is able to lookup records of the given type.
+func verifiable(typ string) bool {
+	switch typ {
+	case "A", "AAAA", "CNAME", "TXT", "MX", "SRV":
+		return true
+	}
+	return false
+}
+
+// lookup resolves the given record and returns its answers.
+func (v *DNSVerifier) lookup(ctx context.Context, hostname, typ string) ([]string, error) {
+	switch typ {
+	case "CNAME":
+		cname, err := v.resolver.LookupCNAME(ctx, hostname)
+		return []string{NormalizeAnswer(typ, cname)}, err
+	case "TXT":
+		return v.resolver.LookupTXT(ctx, hostname)
+	case "MX":
+		mxs, err := v.resolver.LookupMX(ctx, hostname)
+		var answers []string
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, NormalizeAnswer(typ, mx.Host)))
+		}
+		return answers, err
+	case "SRV":
+		// the name already contains the service and protocol, e.g. _sip._tcp.example.com
+		_, srvs, err := v.resolver.LookupSRV(ctx, "", "", hostname)
+		var answers []string
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, NormalizeAnswer(typ, srv.Target)))
+		}
+		return answers, err
+	}
+	network := "ip4"
+	if typ == "AAAA" {
+		network = "ip6"
+	}
+	ips, err := v.resolver.LookupIP(ctx, network, hostname)
+	var answers []string
+	for _, ip := range ips {
+		answers = append(answers, ip.String())
+	}
+	return answers, err
+}
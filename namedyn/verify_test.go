@@ -0,0 +1,85 @@
+package namedyn
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers the lookups of the verifier with the records of home.example.com.
+type fakeResolver struct{}
+
+func (fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "Target.example.net.", nil
+}
+
+func (fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return []string{"a b"}, nil
+}
+
+func (fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return []*net.MX{{Host: "Mail.example.com.", Pref: 10}, {Host: "backup.example.com.", Pref: 20}}, nil
+}
+
+func (fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return name, []*net.SRV{{Target: "SIP.example.com.", Port: 5060, Priority: 10, Weight: 5}}, nil
+}
+
+func (fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if network == "ip6" {
+		return []net.IP{net.ParseIP("2001:db8::1")}, nil
+	}
+	return []net.IP{net.ParseIP("203.0.113.1")}, nil
+}
+
+func TestDNSVerifierLookup(t *testing.T) {
+	tests := []struct {
+		typ  string
+		want []string
+	}{
+		{typ: "A", want: []string{"203.0.113.1"}},
+		{typ: "AAAA", want: []string{"2001:db8::1"}},
+		{typ: "CNAME", want: []string{"target.example.net"}},
+		{typ: "TXT", want: []string{"a b"}},
+		{typ: "MX", want: []string{"10 mail.example.com", "20 backup.example.com"}},
+		{typ: "SRV", want: []string{"10 5 5060 sip.example.com"}},
+	}
+	v := &DNSVerifier{resolver: fakeResolver{}}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			got, err := v.lookup(context.Background(), "home.example.com", tt.typ)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got answers %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSVerifierVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		typ    string
+		answer string
+		want   string
+	}{
+		{name: "propagated", typ: "MX", answer: "10 mail.example.com", want: "change has propagated"},
+		{name: "srv propagated", typ: "SRV", answer: "10 5 5060 sip.example.com", want: "change has propagated"},
+		{name: "not propagated", typ: "MX", answer: "10 other.example.com", want: "change has not propagated within the timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			v := &DNSVerifier{resolver: fakeResolver{}, timeout: 50 * time.Millisecond, interval: 10 * time.Millisecond}
+			v.verify(context.Background(), "home.example.com", tt.typ, tt.answer)
+			if !strings.Contains(logs.String(), tt.want) {
+				t.Errorf("got logs %q, want %q", logs.String(), tt.want)
+			}
+		})
+	}
+}
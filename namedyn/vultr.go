@@ -0,0 +1,162 @@
+package namedyn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VultrRecord represents the dns record type from the vultr api
+// (https://www.vultr.com/api/#tag/dns/operation/list-dns-domain-records).
+type VultrRecord struct {
+	Id   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	// Name is relative to the domain, it is empty for the root record.
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int32  `json:"ttl"`
+}
+
+// VultrListReply represents a page of the reply while listing
+// records using the vultr api, the next page is selected by a cursor.
+type VultrListReply struct {
+	Records []VultrRecord `json:"records"`
+	Meta    struct {
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"meta"`
+}
+
+// VultrProvider manages the records of a domain using the vultr v2 api.
+type VultrProvider struct {
+	cli Doer
+	// baseURL is the url of the api, e.g. https://api.vultr.com/v2.
+	baseURL string
+	apiKey  string
+	domain  string
+}
+
+// NewVultrProvider returns a provider managing the records of the given
+// domain using the vultr api at baseURL and the given api key.
+func NewVultrProvider(cli Doer, baseURL, apiKey, domain string) *VultrProvider {
+	return &VultrProvider{
+		cli:     cli,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		domain:  domain,
+	}
+}
+
+// do sends an authenticated request to the given path of the records of the
+// domain and decodes the reply into v. The operation is used by the metrics.
+func (p *VultrProvider) do(ctx context.Context, operation, method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("error while creating request body: %s", err)
+		}
+	}
+	u := fmt.Sprintf("%s/domains/%s/records%s", p.baseURL, url.PathEscape(p.domain), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, &buf)
+	if err != nil {
+		return fmt.Errorf("error while creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	res, err := timedDo(p.cli, operation, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound && operation == "list" {
+		b, _ := readBody(res.Body)
+		return fmt.Errorf("%w: the vultr domain %s does not exist: %s", ErrDomainNotFound, p.domain, string(b))
+	}
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return fmt.Errorf("could not decode the reply: %s", err)
+		}
+	}
+	return nil
+}
+
+// FindRecords searches for the host records of the given type. All pages
+// of the records are queried, as they can not be filtered by the api.
+func (p *VultrProvider) FindRecords(ctx context.Context, host, typ string) ([]*Record, error) {
+	var records []*Record
+	cursor := ""
+	for {
+		q := url.Values{}
+		q.Set("per_page", "500")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		var reply VultrListReply
+		if err := p.do(ctx, "list", http.MethodGet, "?"+q.Encode(), nil, &reply); err != nil {
+			return nil, fmt.Errorf("error while listing dns records using vultr api: %w", err)
+		}
+		for _, r := range reply.Records {
+			if strings.EqualFold(r.Name, host) && r.Type == typ {
+				records = append(records, &Record{
+					ID:     r.Id,
+					Host:   host,
+					Type:   r.Type,
+					Answer: rrsetAnswer(r.Type, r.Data),
+					TTL:    r.TTL,
+				})
+			}
+		}
+		cursor = reply.Meta.Links.Next
+		if cursor == "" {
+			return records, nil
+		}
+	}
+}
+
+// CreateRecord creates the given record.
+func (p *VultrProvider) CreateRecord(ctx context.Context, rec *Record) error {
+	r := vultrRecord(rec)
+	r.Type = rec.Type
+	var reply struct {
+		Record VultrRecord `json:"record"`
+	}
+	if err := p.do(ctx, "create", http.MethodPost, "", r, &reply); err != nil {
+		return fmt.Errorf("error while creating dns record using vultr api: %s", err)
+	}
+	rec.ID = reply.Record.Id
+	return nil
+}
+
+// UpdateRecord updates the given existing record.
+func (p *VultrProvider) UpdateRecord(ctx context.Context, rec *Record) error {
+	// the type of a record can not be changed
+	if err := p.do(ctx, "update", http.MethodPatch, "/"+url.PathEscape(rec.ID), vultrRecord(rec), nil); err != nil {
+		return fmt.Errorf("error while updating dns record using vultr api: %s", err)
+	}
+	return nil
+}
+
+// DeleteRecord deletes the given existing record.
+func (p *VultrProvider) DeleteRecord(ctx context.Context, rec *Record) error {
+	if err := p.do(ctx, "delete", http.MethodDelete, "/"+url.PathEscape(rec.ID), nil, nil); err != nil {
+		return fmt.Errorf("error while deleting dns record using vultr api: %s", err)
+	}
+	return nil
+}
+
+// vultrRecord converts the given record to a vultr record without its type.
+func vultrRecord(rec *Record) *VultrRecord {
+	return &VultrRecord{
+		Name: rec.Host,
+		Data: rrsetValue(rec.Type, rec.Answer),
+		TTL:  rec.TTL,
+	}
+}
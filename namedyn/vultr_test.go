@@ -0,0 +1,216 @@
+package namedyn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// vultrAPI returns a mock of the vultr api managing the records of example.com
+// on the given pages, the cursor of a page is its index.
+func vultrAPI(pages ...[]VultrRecord) *apiServer {
+	return &apiServer{
+		auth:   headerAuth("Authorization", "Bearer key", `{"error":"Invalid API token.","status":401}`),
+		failed: `{"error":"failed"}`,
+		handle: func(w http.ResponseWriter, r *http.Request, b []byte) {
+			switch r.Method {
+			case http.MethodGet:
+				page, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+				var reply VultrListReply
+				if page < len(pages) {
+					reply.Records = pages[page]
+				}
+				if page+1 < len(pages) {
+					reply.Meta.Links.Next = strconv.Itoa(page + 1)
+				}
+				json.NewEncoder(w).Encode(reply)
+			case http.MethodPost:
+				var rec VultrRecord
+				json.Unmarshal(b, &rec)
+				rec.Id = "r3"
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]interface{}{"record": rec})
+			case http.MethodPatch, http.MethodDelete:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		},
+	}
+}
+
+func TestVultrFindRecords(t *testing.T) {
+	list := "GET /v2/domains/example.com/records?per_page=500"
+	tests := []struct {
+		name     string
+		s        *apiServer
+		apiKey   string
+		host     string
+		typ      string
+		want     []*Record
+		requests []string
+		err      error
+	}{
+		{
+			name: "record",
+			s: vultrAPI([]VultrRecord{
+				{Id: "r1", Type: "A", Name: "home", Data: "203.0.113.1", TTL: 300},
+				{Id: "r2", Type: "AAAA", Name: "home", Data: "2001:db8::1", TTL: 300},
+				{Id: "r3", Type: "A", Name: "nas", Data: "203.0.113.2", TTL: 300},
+			}),
+			host:     "home",
+			typ:      "A",
+			want:     []*Record{{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300}},
+			requests: []string{list},
+		},
+		{
+			name: "record on next page",
+			s: vultrAPI(
+				[]VultrRecord{{Id: "r1", Type: "A", Name: "nas", Data: "203.0.113.2", TTL: 300}},
+				[]VultrRecord{{Id: "r2", Type: "A", Name: "HOME", Data: "203.0.113.1", TTL: 600}},
+			),
+			host:     "home",
+			typ:      "A",
+			want:     []*Record{{ID: "r2", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 600}},
+			requests: []string{list, "GET /v2/domains/example.com/records?cursor=1&per_page=500"},
+		},
+		{
+			name:     "root cname record",
+			s:        vultrAPI([]VultrRecord{{Id: "r1", Type: "CNAME", Name: "", Data: "target.example.net", TTL: 300}}),
+			typ:      "CNAME",
+			want:     []*Record{{ID: "r1", Host: "", Type: "CNAME", Answer: "target.example.net", TTL: 300}},
+			requests: []string{list},
+		},
+		{
+			name:     "not found",
+			s:        vultrAPI(),
+			host:     "home",
+			typ:      "A",
+			requests: []string{list},
+		},
+		{
+			name:     "domain not found",
+			s:        vultrAPI().fail(http.MethodGet, http.StatusNotFound),
+			host:     "home",
+			typ:      "A",
+			requests: []string{list},
+			err:      ErrDomainNotFound,
+		},
+		{
+			name:     "unauthorized",
+			s:        vultrAPI(),
+			apiKey:   "wrong",
+			host:     "home",
+			typ:      "A",
+			requests: []string{list},
+			err:      ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey := tt.apiKey
+			if apiKey == "" {
+				apiKey = "key"
+			}
+			srv := tt.s.start(t)
+			p := NewVultrProvider(srv.Client(), srv.URL+"/v2/", apiKey, "example.com")
+			got, err := p.FindRecords(context.Background(), tt.host, tt.typ)
+			checkError(t, err, tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got records %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestVultrChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *apiServer
+		// op is the change applied, one of create, update and delete.
+		op       string
+		rec      Record
+		id       string
+		requests []string
+		err      error
+	}{
+		{
+			name:     "create",
+			s:        vultrAPI(),
+			op:       "create",
+			rec:      Record{Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r3",
+			requests: []string{`POST /v2/domains/example.com/records {"type":"A","name":"home","data":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "create txt record",
+			s:        vultrAPI(),
+			op:       "create",
+			rec:      Record{Host: "_acme", Type: "TXT", Answer: "a b", TTL: 300},
+			id:       "r3",
+			requests: []string{`POST /v2/domains/example.com/records {"type":"TXT","name":"_acme","data":"\"a b\"","ttl":300}`},
+		},
+		{
+			name:     "update",
+			s:        vultrAPI(),
+			op:       "update",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{`PATCH /v2/domains/example.com/records/r1 {"name":"home","data":"203.0.113.1","ttl":300}`},
+		},
+		{
+			name:     "delete",
+			s:        vultrAPI(),
+			op:       "delete",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{"DELETE /v2/domains/example.com/records/r1"},
+		},
+		{
+			name:     "update rejected",
+			s:        vultrAPI().fail(http.MethodPatch, http.StatusBadRequest),
+			op:       "update",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{`PATCH /v2/domains/example.com/records/r1 {"name":"home","data":"203.0.113.1","ttl":300}`},
+			err:      errors.New(`error while updating dns record using vultr api: unexpected status code 400: {"error":"failed"}`),
+		},
+		{
+			name:     "delete missing record",
+			s:        vultrAPI().fail(http.MethodDelete, http.StatusNotFound),
+			op:       "delete",
+			rec:      Record{ID: "r1", Host: "home", Type: "A", Answer: "203.0.113.1", TTL: 300},
+			id:       "r1",
+			requests: []string{"DELETE /v2/domains/example.com/records/r1"},
+			err:      errors.New("error while deleting dns record using vultr api: unexpected status code 404"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.s.start(t)
+			p := NewVultrProvider(srv.Client(), srv.URL+"/v2/", "key", "example.com")
+			rec := tt.rec
+			var err error
+			switch tt.op {
+			case "create":
+				err = p.CreateRecord(context.Background(), &rec)
+			case "update":
+				err = p.UpdateRecord(context.Background(), &rec)
+			case "delete":
+				err = p.DeleteRecord(context.Background(), &rec)
+			}
+			checkError(t, err, tt.err)
+			if rec.ID != tt.id {
+				t.Errorf("got id %q, want %q", rec.ID, tt.id)
+			}
+			if !reflect.DeepEqual(tt.s.requests, tt.requests) {
+				t.Errorf("got requests %q, want %q", tt.s.requests, tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges switches the process to the given user, given by name or
+// uid, and its primary group. It needs to be called after binding privileged
+// ports, as the user is usually not allowed to bind them.
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return fmt.Errorf("could not find user %s: %s", name, err)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid %s of user %s", u.Uid, name)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid %s of user %s", u.Gid, name)
+	}
+	// the groups need to be changed first, as the user is no longer allowed
+	// to change them after setuid
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("error while setting supplementary groups: %s", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("error while setting gid %v: %s", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("error while setting uid %v: %s", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// dropPrivileges is not supported on this platform.
+func dropPrivileges(name string) error {
+	return fmt.Errorf("switching users is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// build information, set using -ldflags, e.g.
+// go build -ldflags "-X main.version=0.0.1 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// versionString returns the build information including the go runtime version.
+func versionString() string {
+	return fmt.Sprintf("namedyn %s (commit %s, built %s, %s)", version, commit, date, runtime.Version())
+}
+
+// defaultUserAgent returns the user agent sent by default.
+func defaultUserAgent() string {
+	return "namedyn/" + version + " (+https://github.com/rbicker/namedyn)"
+}